@@ -0,0 +1,106 @@
+// hessian inspects hessian payloads.
+//
+//   hessian dump [--hex] [--v1] [file]
+//   hessian json [--reverse] [--prefix $] [--plain-longs] [--unix-dates] [file]
+//
+// dump prints the values of the payload in file, or stdin, as an indented
+// tree with the offset, leading byte and decoded type of each value. --hex
+// prints every byte next to the value it belongs to, --v1 reads the payload
+// as hessian 1.0
+//
+// json converts the payload to indented json annotated with type names,
+// longs, dates, binaries and refs, --reverse converts such json back to hessian
+package main
+
+import (
+  "bytes"
+  "encoding/json"
+  "flag"
+  "fmt"
+  "io/ioutil"
+  "os"
+
+  hessian "github.com/skyitachi/hessian-go/src"
+)
+
+func usage() {
+  fmt.Fprintln(os.Stderr, "usage: hessian dump [--hex] [--v1] [file]")
+  fmt.Fprintln(os.Stderr, "       hessian json [--reverse] [--prefix $] [--plain-longs] [--unix-dates] [file]")
+  os.Exit(2)
+}
+
+func main() {
+  if len(os.Args) < 2 {
+    usage()
+  }
+  switch os.Args[1] {
+  case "dump":
+    dump(os.Args[2:])
+  case "json":
+    convert(os.Args[2:])
+  default:
+    usage()
+  }
+}
+
+// readInput reads the file named by the only argument, or stdin
+func readInput(flags *flag.FlagSet) ([]byte, error) {
+  switch flags.NArg() {
+  case 0:
+    return ioutil.ReadAll(os.Stdin)
+  case 1:
+    return ioutil.ReadFile(flags.Arg(0))
+  }
+  usage()
+  return nil, nil
+}
+
+func fail(err error) {
+  fmt.Fprintln(os.Stderr, "hessian:", err)
+  os.Exit(1)
+}
+
+func dump(args []string) {
+  flags := flag.NewFlagSet("dump", flag.ExitOnError)
+  var options hessian.DumpOptions
+  flags.BoolVar(&options.Hex, "hex", false, "print every byte next to its value")
+  flags.BoolVar(&options.V1, "v1", false, "read the payload as hessian 1.0")
+  flags.Parse(args)
+  b, err := readInput(flags)
+  if err != nil {
+    fail(err)
+  }
+  if err := hessian.Dump(os.Stdout, b, options); err != nil {
+    fail(err)
+  }
+}
+
+func convert(args []string) {
+  flags := flag.NewFlagSet("json", flag.ExitOnError)
+  convention := hessian.DefaultJSONConvention
+  reverse := flags.Bool("reverse", false, "convert json to hessian")
+  flags.StringVar(&convention.Prefix, "prefix", convention.Prefix, "prefix of the annotation keys")
+  flags.BoolVar(&convention.PlainLongs, "plain-longs", false, "write longs as json numbers")
+  flags.BoolVar(&convention.UnixDates, "unix-dates", false, "write dates as milliseconds since the epoch")
+  flags.Parse(args)
+  b, err := readInput(flags)
+  if err != nil {
+    fail(err)
+  }
+  if *reverse {
+    code, err := convention.FromJSON(b)
+    if err != nil {
+      fail(err)
+    }
+    os.Stdout.Write(code)
+    return
+  }
+  ret, err := convention.ToJSON(b)
+  if err != nil {
+    fail(err)
+  }
+  var out bytes.Buffer
+  json.Indent(&out, ret, "", "  ")
+  out.WriteByte('\n')
+  os.Stdout.Write(out.Bytes())
+}
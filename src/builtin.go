@@ -0,0 +1,228 @@
+package hessian
+
+import (
+  "encoding/binary"
+  "encoding/hex"
+  "fmt"
+  "math/big"
+  "strings"
+  "time"
+)
+
+// mappings of common java library types, registered as custom serializers
+
+// Decimal is a java.math.BigDecimal, written by java as an object
+// with its string form in the value field
+type Decimal string
+
+func (Decimal) JavaClassName() string {
+  return "java.math.BigDecimal"
+}
+
+// Float returns the decimal as *big.Float
+func (d Decimal) Float() (*big.Float, bool) {
+  return new(big.Float).SetString(string(d))
+}
+
+// UUID is a java.util.UUID, written by java as an object with
+// mostSigBits and leastSigBits fields
+type UUID [16]byte
+
+func (UUID) JavaClassName() string {
+  return "java.util.UUID"
+}
+
+func (u UUID) String() string {
+  s := hex.EncodeToString(u[:])
+  return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// Locale is a java.util.Locale like "en_US", written by java as a
+// com.caucho.hessian.io.LocaleHandle object with the string in its value field
+type Locale string
+
+func (Locale) JavaClassName() string {
+  return "java.util.Locale"
+}
+
+// Currency is a java.util.Currency by its ISO 4217 code like "EUR"
+type Currency string
+
+func (Currency) JavaClassName() string {
+  return "java.util.Currency"
+}
+
+const localeHandle = "com.caucho.hessian.io.LocaleHandle"
+
+func init() {
+  RegisterSerializer("java.math.BigDecimal", nil, SerializerFunc(func(v interface{}) (interface{}, error) {
+    return stringValueObject("java.math.BigDecimal", "value", string(v.(Decimal))), nil
+  }))
+  RegisterDeserializer("java.math.BigDecimal", DeserializerFunc(func(v interface{}) (interface{}, error) {
+    s, err := stringField(v, "value")
+    return Decimal(s), err
+  }))
+
+  RegisterSerializer("java.math.BigInteger", big.Int{}, SerializerFunc(serializeBigInt))
+  RegisterDeserializer("java.math.BigInteger", DeserializerFunc(deserializeBigInt))
+
+  RegisterSerializer("java.util.UUID", nil, SerializerFunc(func(v interface{}) (interface{}, error) {
+    u := v.(UUID)
+    return Object{
+      ValueType: "java.util.UUID",
+      Fields: []string{"mostSigBits", "leastSigBits"},
+      Value: []interface{}{int64(binary.BigEndian.Uint64(u[:8])), int64(binary.BigEndian.Uint64(u[8:]))},
+    }, nil
+  }))
+  RegisterDeserializer("java.util.UUID", DeserializerFunc(func(v interface{}) (interface{}, error) {
+    var u UUID
+    most, err := longField(v, "mostSigBits")
+    if err != nil {
+      return nil, err
+    }
+    least, err := longField(v, "leastSigBits")
+    if err != nil {
+      return nil, err
+    }
+    binary.BigEndian.PutUint64(u[:8], uint64(most))
+    binary.BigEndian.PutUint64(u[8:], uint64(least))
+    return u, nil
+  }))
+
+  RegisterSerializer("java.util.Locale", nil, SerializerFunc(func(v interface{}) (interface{}, error) {
+    return stringValueObject(localeHandle, "value", string(v.(Locale))), nil
+  }))
+  deserializeLocale := DeserializerFunc(func(v interface{}) (interface{}, error) {
+    if s, err := stringField(v, "value"); err == nil {
+      return Locale(s), nil
+    }
+    // a locale written field by field
+    language, err := stringField(v, "language")
+    if err != nil {
+      return nil, err
+    }
+    parts := []string{language}
+    for _, name := range []string{"country", "variant"} {
+      if s, _ := stringField(v, name); s != "" {
+        parts = append(parts, s)
+      }
+    }
+    return Locale(strings.Join(parts, "_")), nil
+  })
+  RegisterDeserializer(localeHandle, deserializeLocale)
+  RegisterDeserializer("java.util.Locale", deserializeLocale)
+
+  RegisterSerializer("java.util.Currency", nil, SerializerFunc(func(v interface{}) (interface{}, error) {
+    return stringValueObject("java.util.Currency", "currencyCode", string(v.(Currency))), nil
+  }))
+  RegisterDeserializer("java.util.Currency", DeserializerFunc(func(v interface{}) (interface{}, error) {
+    s, err := stringField(v, "currencyCode")
+    return Currency(s), err
+  }))
+
+  // java.util.Date is a date value already, the java.sql types are objects holding one
+  for _, name := range []string{"java.sql.Timestamp", "java.sql.Date", "java.sql.Time"} {
+    RegisterDeserializer(name, DeserializerFunc(func(v interface{}) (interface{}, error) {
+      value := mapEntries(v)["value"]
+      switch t := value.(type) {
+      case time.Time:
+        return t, nil
+      case int64:
+        return time.Unix(t / 1000, t % 1000 * 1e6), nil
+      }
+      return nil, fmt.Errorf("value is %T, date expected", value)
+    }))
+  }
+}
+
+func stringValueObject(className, field, s string) Object {
+  return Object{ValueType: className, Fields: []string{field}, Value: []interface{}{s}}
+}
+
+func stringField(v interface{}, name string) (string, error) {
+  value, ok := mapEntries(v)[name]
+  s, isString := value.(string)
+  if !ok || !isString {
+    return "", fmt.Errorf("field %s is %T, string expected", name, value)
+  }
+  return s, nil
+}
+
+func longField(v interface{}, name string) (int64, error) {
+  switch value := mapEntries(v)[name].(type) {
+  case int64:
+    return value, nil
+  case int32:
+    return int64(value), nil
+  default:
+    return 0, fmt.Errorf("field %s is %T, long expected", name, value)
+  }
+}
+
+// a BigInteger is written by java with its sign and its magnitude
+// as big-endian int words
+func serializeBigInt(v interface{}) (interface{}, error) {
+  n := v.(big.Int)
+  abs := n.Bytes()
+  if pad := len(abs) % 4; pad != 0 {
+    abs = append(make([]byte, 4 - pad), abs...)
+  }
+  mag := make([]int32, len(abs) / 4)
+  for i := range mag {
+    mag[i] = int32(binary.BigEndian.Uint32(abs[i * 4:]))
+  }
+  return Object{
+    ValueType: "java.math.BigInteger",
+    Fields: []string{"signum", "mag"},
+    Value: []interface{}{int32(n.Sign()), mag},
+  }, nil
+}
+
+func deserializeBigInt(v interface{}) (interface{}, error) {
+  if s, err := stringField(v, "value"); err == nil {
+    n, ok := new(big.Int).SetString(s, 10)
+    if !ok {
+      return nil, fmt.Errorf("invalid integer %q", s)
+    }
+    return n, nil
+  }
+  fields := mapEntries(v)
+  signum, err := longField(v, "signum")
+  if err != nil {
+    return nil, err
+  }
+  var words []int32
+  switch mag := fields["mag"].(type) {
+  case []int32:
+    words = mag
+  case *List:
+    for _, word := range mag.Value {
+      w, ok := word.(int32)
+      if !ok {
+        return nil, fmt.Errorf("mag word is %T, int expected", word)
+      }
+      words = append(words, w)
+    }
+  default:
+    return nil, fmt.Errorf("field mag is %T, int list expected", mag)
+  }
+  abs := make([]byte, 4 * len(words))
+  for i, w := range words {
+    binary.BigEndian.PutUint32(abs[i * 4:], uint32(w))
+  }
+  n := new(big.Int).SetBytes(abs)
+  if signum < 0 {
+    n.Neg(n)
+  }
+  return n, nil
+}
+
+// isEnum reports whether object is a java enum, written by java
+// as an object whose only field is its name
+func isEnum(object *Object) bool {
+  if len(object.Fields) != 1 || object.Fields[0] != "name" {
+    return false
+  }
+  _, ok := object.Value[0].(string)
+  return ok
+}
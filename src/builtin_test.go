@@ -0,0 +1,122 @@
+package hessian
+
+import (
+  "math/big"
+  "testing"
+  "time"
+)
+
+func TestBuiltinRoundTrip(t *testing.T) {
+  big1, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+  uuid := UUID{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+  tests := []struct {
+    v interface{}
+    className string
+    expect interface{}
+  }{
+    {Decimal("-12.340"), "java.math.BigDecimal", Decimal("-12.340")},
+    {uuid, "java.util.UUID", uuid},
+    {Locale("en_US"), localeHandle, Locale("en_US")},
+    {Currency("EUR"), "java.util.Currency", Currency("EUR")},
+  }
+  for _, test := range tests {
+    code := mustMarshal(t, test.v)
+    object, err := NewDecoder(code).ReadObject()
+    unexpected_error(err, t)
+    if object.ValueType != test.className {
+      t.Errorf("builtin: %T written as %s", test.v, object.ValueType)
+    }
+    v, err := NewDecoder(code).ReadValue()
+    unexpected_error(err, t)
+    if v != test.expect {
+      t.Errorf("builtin: expect %v found %v", test.expect, v)
+    }
+  }
+  if uuid.String() != "123e4567-e89b-12d3-a456-426614174000" {
+    t.Errorf("builtin: uuid string error, found %s", uuid.String())
+  }
+  for _, n := range []*big.Int{big1, big.NewInt(0), big.NewInt(1 << 40)} {
+    v, err := NewDecoder(mustMarshal(t, n)).ReadValue()
+    unexpected_error(err, t)
+    if ret, ok := v.(*big.Int); !ok || ret.Cmp(n) != 0 {
+      t.Errorf("builtin: expect %s found %v", n, v)
+    }
+  }
+}
+
+func TestBuiltinJavaValues(t *testing.T) {
+  ts := time.Unix(1504067708, 366e6)
+  encoder := NewEncoder()
+  encoder.WriteObject(Object{ValueType: "java.sql.Timestamp", Fields: []string{"value"}, Value: []interface{}{ts}})
+  // enum com.acme.Color.RED
+  encoder.WriteObject(Object{ValueType: "com.acme.Color", Fields: []string{"name"}, Value: []interface{}{"RED"}})
+  encoder.WriteObject(Object{ValueType: "java.math.BigInteger", Fields: []string{"signum", "mag"},
+    Value: []interface{}{int32(-1), List{"[int", []interface{}{int32(1), int32(0)}}}})
+  encoder.WriteObject(Object{ValueType: "java.util.Locale", Fields: []string{"language", "country", "variant"},
+    Value: []interface{}{"de", "CH", ""}})
+  decoder := NewDecoder(encoder.Bytes())
+  // enums keep their class, Decode names them
+  expect := []interface{}{ts, "com.acme.Color", big.NewInt(-1 << 32), Locale("de_CH")}
+  for _, e := range expect {
+    v, err := decoder.ReadValue()
+    unexpected_error(err, t)
+    if object, ok := v.(*Object); ok {
+      if name, _ := object.Get("name"); object.ValueType != e || name != "RED" {
+        t.Errorf("builtin: expect enum %v found %v", e, v)
+      }
+      continue
+    }
+    if n, ok := e.(*big.Int); ok {
+      if ret, ok := v.(*big.Int); !ok || ret.Cmp(n) != 0 {
+        t.Errorf("builtin: expect %s found %v", n, v)
+      }
+      continue
+    }
+    if v != e {
+      t.Errorf("builtin: expect %v found %v", e, v)
+    }
+  }
+}
+
+func TestBuiltinUnmarshal(t *testing.T) {
+  type payment struct {
+    ID UUID `hessian:"id"`
+    Ref string `hessian:"ref"`
+    Amount Decimal `hessian:"amount"`
+    Raw string `hessian:"raw"`
+    Total big.Int `hessian:"total"`
+    Status string `hessian:"status"`
+  }
+  uuid := UUID{1, 2, 3}
+  code := mustMarshal(t, map[string]interface{}{
+    "id": uuid,
+    "ref": uuid,
+    "amount": Decimal("9.99"),
+    "raw": Decimal("1.5"),
+    "total": big.NewInt(42),
+    "status": Object{ValueType: "com.acme.Status", Fields: []string{"name"}, Value: []interface{}{"PAID"}},
+  })
+  var ret payment
+  unexpected_error(Unmarshal(code, &ret), t)
+  if ret.ID != uuid || ret.Ref != uuid.String() || ret.Amount != "9.99" || ret.Raw != "1.5" ||
+    ret.Total.Int64() != 42 || ret.Status != "PAID" {
+    t.Errorf("builtin: unmarshal error, found %+v", ret)
+  }
+
+  // classes with a single name field are enums only for strings and interfaces
+  type tag struct {
+    Name string `hessian:"name"`
+  }
+  code = mustMarshal(t, Object{ValueType: "com.acme.Tag", Fields: []string{"name"}, Value: []interface{}{"go"}})
+  var s tag
+  unexpected_error(Unmarshal(code, &s), t)
+  var m map[string]string
+  unexpected_error(Unmarshal(code, &m), t)
+  var name string
+  unexpected_error(Unmarshal(code, &name), t)
+  var v interface{}
+  unexpected_error(Unmarshal(code, &v), t)
+  if s.Name != "go" || m["name"] != "go" || name != "go" || v != "go" {
+    t.Errorf("builtin: enum decode error, found %+v %v %q %v", s, m, name, v)
+  }
+}
@@ -0,0 +1,150 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "fmt"
+  "net/http"
+  "reflect"
+)
+
+const ContentType = "x-application/hessian"
+
+// Client calls a hessian service over http, like a Caucho or Spring
+// HessianServiceExporter endpoint
+type Client struct {
+  URL string
+  HTTPClient *http.Client
+  // Options bounds the replies read
+  Options DecoderOptions
+}
+
+// NewClient returns a client for the service at url, http.DefaultClient
+// is used when httpClient is nil
+func NewClient(url string, httpClient *http.Client) *Client {
+  if httpClient == nil {
+    httpClient = http.DefaultClient
+  }
+  return &Client{
+    URL: url,
+    HTTPClient: httpClient,
+  }
+}
+
+// Call invokes method and returns the decoded reply value,
+// a fault reply is returned as *Fault error
+func (client *Client) Call(method string, args ...interface{}) (interface{}, error) {
+  v, err := client.call(method, args)
+  if err != nil {
+    return nil, err
+  }
+  return newAssigner().resolve(v)
+}
+
+// call returns the reply value without resolving registered classes,
+// for Invoke and Proxy to assign it like Decode does
+func (client *Client) call(method string, args []interface{}) (interface{}, error) {
+  encoder := NewEncoder()
+  if err := encoder.WriteCall(method, args...); err != nil {
+    return nil, err
+  }
+  resp, err := client.HTTPClient.Post(client.URL, ContentType, bytes.NewReader(encoder.Bytes()))
+  if err != nil {
+    return nil, err
+  }
+  defer resp.Body.Close()
+  decoder := NewDecoderReader(resp.Body)
+  decoder.SetOptions(client.Options)
+  if resp.StatusCode != http.StatusOK {
+    // some servers send the fault with an error status
+    if _, err := decoder.readReply(); err != nil {
+      var fault *Fault
+      if errors.As(err, &fault) {
+        return nil, fault
+      }
+    }
+    return nil, fmt.Errorf("hessian: %s replied %s", client.URL, resp.Status)
+  }
+  return decoder.readReply()
+}
+
+// Invoke is like Call but stores the reply in the value pointed to by reply,
+// see Decoder.Decode
+func (client *Client) Invoke(method string, reply interface{}, args ...interface{}) error {
+  rv := reflect.ValueOf(reply)
+  if rv.Kind() != reflect.Ptr || rv.IsNil() {
+    return errors.New("hessian: invoke needs a non-nil reply pointer")
+  }
+  v, err := client.call(method, args)
+  if err != nil {
+    return err
+  }
+  return newAssigner().assign(rv.Elem(), v)
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// Proxy fills the func fields of the struct pointed to by service with
+// functions calling the remote methods. the method name is taken from the
+// `hessian` tag or the field name with the first letter lowered, the
+// functions return an optional value and an error, like
+//
+//   type Greeter struct {
+//     Hello func(name string) (string, error) `hessian:"hello"`
+//   }
+func (client *Client) Proxy(service interface{}) error {
+  rv := reflect.ValueOf(service)
+  if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+    return errors.New("hessian: proxy needs a pointer to struct")
+  }
+  rv = rv.Elem()
+  for i := 0; i < rv.NumField(); i++ {
+    sf := rv.Type().Field(i)
+    if sf.Type.Kind() != reflect.Func || sf.PkgPath != "" {
+      continue
+    }
+    name, _ := parseTag(sf.Tag.Get("hessian"))
+    if name == "-" {
+      continue
+    }
+    if name == "" {
+      name = lowerFirst(sf.Name)
+    }
+    ft := sf.Type
+    if ft.NumOut() < 1 || ft.NumOut() > 2 || ft.Out(ft.NumOut() - 1) != errorType {
+      return fmt.Errorf("hessian: proxy func %s must return an optional value and an error", sf.Name)
+    }
+    rv.Field(i).Set(reflect.MakeFunc(ft, client.proxyFunc(name, ft)))
+  }
+  return nil
+}
+
+func (client *Client) proxyFunc(method string, ft reflect.Type) func([]reflect.Value) []reflect.Value {
+  return func(in []reflect.Value) []reflect.Value {
+    args := make([]interface{}, 0, len(in))
+    for i, arg := range in {
+      if ft.IsVariadic() && i == len(in) - 1 {
+        for j := 0; j < arg.Len(); j++ {
+          args = append(args, arg.Index(j).Interface())
+        }
+        continue
+      }
+      args = append(args, arg.Interface())
+    }
+    out := make([]reflect.Value, ft.NumOut())
+    for i := range out {
+      out[i] = reflect.Zero(ft.Out(i))
+    }
+    v, err := client.call(method, args)
+    if err == nil && ft.NumOut() == 2 {
+      ret := reflect.New(ft.Out(0)).Elem()
+      if err = newAssigner().assign(ret, v); err == nil {
+        out[0] = ret
+      }
+    }
+    if err != nil {
+      out[len(out) - 1] = reflect.ValueOf(&err).Elem()
+    }
+    return out
+  }
+}
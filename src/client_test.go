@@ -0,0 +1,95 @@
+package hessian
+
+import (
+  "errors"
+  "net/http"
+  "net/http/httptest"
+  "testing"
+)
+
+// a stand-in for a java service with add2 and fail methods
+func newTestService(t *testing.T) *httptest.Server {
+  return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost || r.Header.Get("Content-Type") != ContentType {
+      t.Errorf("client: unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+    }
+    method, args, err := NewDecoderReader(r.Body).ReadCall()
+    if err != nil {
+      http.Error(w, err.Error(), http.StatusBadRequest)
+      return
+    }
+    // headers set after WriteHeader are not sent
+    w.Header().Set("Content-Type", ContentType)
+    encoder := NewEncoder()
+    switch method {
+    case "add2":
+      encoder.WriteReply(args[0].(int32) + args[1].(int32))
+    case "fail":
+      encoder.WriteFault(&Fault{Code: "ServiceException", Message: "failed"})
+    default:
+      w.WriteHeader(http.StatusInternalServerError)
+      encoder.WriteFault(&Fault{Code: "NoSuchMethodException", Message: method})
+    }
+    w.Write(encoder.Bytes())
+  }))
+}
+
+func TestClientCall(t *testing.T) {
+  server := newTestService(t)
+  defer server.Close()
+  client := NewClient(server.URL, server.Client())
+  v, err := client.Call("add2", int32(2), int32(3))
+  unexpected_error(err, t)
+  if v != int32(5) {
+    t.Errorf("call: expect 5 found %v", v)
+  }
+  var n int
+  unexpected_error(client.Invoke("add2", &n, int32(2), int32(3)), t)
+  if n != 5 {
+    t.Errorf("invoke: expect 5 found %d", n)
+  }
+  var fault *Fault
+  _, err = client.Call("fail")
+  if !errors.As(err, &fault) || fault.Code != "ServiceException" || fault.Message != "failed" {
+    t.Errorf("call: expect fault found %v", err)
+  }
+  // fault with an error status
+  _, err = client.Call("missing")
+  if !errors.As(err, &fault) || fault.Code != "NoSuchMethodException" {
+    t.Errorf("call: expect fault found %v", err)
+  }
+  // replies are read with the options of the client
+  client.Options = DecoderOptions{MaxTotalBytes: 4}
+  if _, err := client.Call("add2", int32(2), int32(3)); !errors.Is(err, ErrMaxTotalBytes) {
+    t.Errorf("call: expect %v found %v", ErrMaxTotalBytes, err)
+  }
+}
+
+func TestClientProxy(t *testing.T) {
+  server := newTestService(t)
+  defer server.Close()
+  var service struct {
+    Add2 func(a, b int32) (int64, error)
+    Fail func() error
+    Missing func() error `hessian:"noSuchMethod"`
+  }
+  unexpected_error(NewClient(server.URL, server.Client()).Proxy(&service), t)
+  n, err := service.Add2(2, 3)
+  unexpected_error(err, t)
+  if n != 5 {
+    t.Errorf("proxy: expect 5 found %d", n)
+  }
+  var fault *Fault
+  if err := service.Fail(); !errors.As(err, &fault) || fault.Code != "ServiceException" {
+    t.Errorf("proxy: expect fault found %v", err)
+  }
+  if err := service.Missing(); !errors.As(err, &fault) || fault.Message != "noSuchMethod" {
+    t.Errorf("proxy: expect fault found %v", err)
+  }
+  var bad struct {
+    Add2 func(a, b int32) int32
+  }
+  if err := NewClient(server.URL, nil).Proxy(&bad); err == nil {
+    t.Errorf("proxy: expect error for func without error result")
+  }
+}
@@ -9,20 +9,45 @@ func addCode(code byte, typeName string) {
 func addCodeRange(start byte, end byte, typeName string) {
   for i := start; i <= end; i++ {
     CODE_TO_TYPE[i] = typeName
+    if i == end {
+      break
+    }
   }
 }
 
 func init() {
+  addCode(0x4e, "null")
   addCode(0x91, "int")
   addCode(0x49, "int")
   addCodeRange(0x80, 0xbf, "int")
   addCodeRange(0xc0, 0xcf, "int")
   addCodeRange(0xd0, 0xd7, "int")
+  addCode(0x4c, "long")
+  addCode(0x59, "long")
+  addCodeRange(0xd8, 0xef, "long")
+  addCodeRange(0xf0, 0xff, "long")
+  addCodeRange(0x38, 0x3f, "long")
+  addCode(0x44, "double")
+  addCodeRange(0x5b, 0x5f, "double")
+  addCode(0x4a, "date")
+  addCode(0x4b, "date")
   addCode(0x54, "bool")
   addCode(0x46, "bool")
   addCode(0x53, "string")
   addCode(0x52, "string")
   addCodeRange(0x00, 0x1f, "string")
   addCodeRange(0x30, 0x33, "string")
+  addCode(0x41, "binary")
+  addCode(0x42, "binary")
+  addCode(0x62, "binary")
+  addCodeRange(0x20, 0x2f, "binary")
+  addCodeRange(0x34, 0x37, "binary")
+  addCodeRange(0x55, 0x58, "list")
+  addCodeRange(0x70, 0x7f, "list")
+  addCode(0x48, "map")
   addCode(0x4d, "typedmap")
+  addCode(0x43, "object")
+  addCode(0x4f, "object")
+  addCodeRange(0x60, 0x6f, "object")
+  addCode(0x51, "ref")
 }
@@ -1,10 +1,15 @@
 package hessian
 
 import (
+  "bufio"
 	"bytes"
 	"errors"
+  "io"
+  "unicode/utf16"
+  "unicode/utf8"
 	"time"
   "fmt"
+  "reflect"
 )
 const UNTYPED = "untyped"
 var TIME_DEFAULT_VALUE = time.Unix(0, 0)
@@ -19,121 +24,385 @@ type TypedMap struct {
   Value map[string]interface{}
 }
 
+// class definition, shared by the object instances that follow it
+type ClassDef struct {
+  ValueType string
+  Fields []string
+}
+
+// object instance, Value holds the field values in the order of Fields
+type Object struct {
+  ValueType string
+  Fields []string
+  Value []interface{}
+}
+
+func (object *Object) Get(field string) (interface{}, bool) {
+  for i, name := range object.Fields {
+    if name == field {
+      return object.Value[i], true
+    }
+  }
+  return nil, false
+}
+
+// TypedMap returns the object as a typed map keyed by field name
+func (object *Object) TypedMap() TypedMap {
+  ret := TypedMap{
+    ValueType: object.ValueType,
+    Value: make(map[string]interface{}, len(object.Fields)),
+  }
+  for i, name := range object.Fields {
+    ret.Value[name] = object.Value[i]
+  }
+  return ret
+}
+
+// what the decoder reads from, satisfied by *bytes.Buffer and *bufio.Reader
+type byteReader interface {
+  io.Reader
+  io.ByteScanner
+}
+
+// size of the buffer used by NewDecoderReader
+const readerBufferSize = 4096
+
 type Decoder struct {
-	buf       *bytes.Buffer
-  lastChunk bool
-  types []string
-  refMap map[int32]interface{}
+	buf       byteReader
+  types []string // type-refs
+  classDefs []ClassDef
+  refMap map[int32]interface{} // value refs
   refId int32
-  byteCount int32 // how many bytes read after last successful read, for recovery
-  runeCount int32 // ...
+  offset int64 // position of the next byte in the input
+  pending []byte // bytes given back by Reset, read before buf
+  marked bool
+  markStart int64 // offset of the oldest mark
+  record []byte // bytes read since markStart
+  marks []decoderMark
+  v1 bool // hessian 1.0 input, see NewDecoderV1
+  depth int // nesting of ReadValue calls
+  resolver *assigner // resolves registered classes, see RegisterType
+  tokens []tokenFrame // containers opened by Token
+  options DecoderOptions
 }
 
 var emptyTypedMap = TypedMap{}
 
+// the tables of the decoder at a mark, Reset truncates them back so that
+// the values read again are numbered as the first time
+type decoderMark struct {
+  offset int64
+  types int
+  classDefs int
+  refId int32
+  tokens []tokenFrame
+}
+
 func NewDecoder(b []byte) *Decoder {
 	return &Decoder{
     buf:bytes.NewBuffer(b),
-    lastChunk: false,
     types: []string{},
+    classDefs: []ClassDef{},
     refMap: make(map[int32]interface{}),
     refId: 0,
-    byteCount: 0,
-    runeCount: 0,
+    offset: 0,
   }
 }
 
-func (decoder *Decoder) success() {
-  decoder.byteCount = 0
-  decoder.runeCount = 0
+// NewDecoderReader returns a decoder that reads from r on demand
+// through a bounded buffer, the whole message is never held in memory
+func NewDecoderReader(r io.Reader) *Decoder {
+  decoder := NewDecoder(nil)
+  decoder.buf = bufio.NewReaderSize(r, readerBufferSize)
+  return decoder
 }
 
-func (decoder *Decoder) Recover() {
-  // FIXME: have problems 顺序问题
-  decoder.unread_n_byte(decoder.byteCount)
-  decoder.unread_n_rune(decoder.runeCount)
-  decoder.success()
+// Offset returns the position of the next byte in the input
+func (decoder *Decoder) Offset() int64 {
+  return decoder.offset
+}
+
+// Mark returns the current offset, the bytes read after it are kept
+// so that Reset can go back to it until Release is called
+func (decoder *Decoder) Mark() int64 {
+  if !decoder.marked {
+    decoder.marked = true
+    decoder.markStart = decoder.offset
+    decoder.record = decoder.record[:0]
+  }
+  decoder.marks = append(decoder.marks, decoderMark{
+    offset: decoder.offset,
+    types: len(decoder.types),
+    classDefs: len(decoder.classDefs),
+    refId: decoder.refId,
+    tokens: append([]tokenFrame{}, decoder.tokens...),
+  })
+  return decoder.offset
+}
+
+// Reset goes back to a mark, the bytes after it are read again. the types,
+// class definitions and refs read after the mark are dropped, later marks
+// become invalid
+func (decoder *Decoder) Reset(mark int64) error {
+  n := len(decoder.marks)
+  for n > 0 && decoder.marks[n - 1].offset != mark {
+    n--
+  }
+  if !decoder.marked || n == 0 || mark > decoder.offset {
+    return errors.New("hessian: reset to an invalid mark")
+  }
+  saved := decoder.marks[n - 1]
+  decoder.marks = decoder.marks[:n]
+  decoder.types = decoder.types[:saved.types]
+  decoder.classDefs = decoder.classDefs[:saved.classDefs]
+  for id := saved.refId; id < decoder.refId; id++ {
+    delete(decoder.refMap, id)
+  }
+  decoder.refId = saved.refId
+  decoder.tokens = append(decoder.tokens[:0], saved.tokens...)
+  i := int(mark - decoder.markStart)
+  pending := make([]byte, 0, len(decoder.record) - i + len(decoder.pending))
+  pending = append(pending, decoder.record[i:]...)
+  decoder.pending = append(pending, decoder.pending...)
+  decoder.record = decoder.record[:i]
+  decoder.offset = mark
+  return nil
+}
+
+// Release drops the bytes kept for Reset, all marks become invalid
+func (decoder *Decoder) Release() {
+  decoder.marked = false
+  decoder.record = nil
+  decoder.marks = nil
+}
+
+// Peek returns the next byte without consuming it
+func (decoder *Decoder) Peek() (byte, error) {
+  return decoder.peek()
+}
+
+func (decoder *Decoder) peek() (byte, error) {
+  if len(decoder.pending) > 0 {
+    return decoder.pending[0], nil
+  }
+  code, err := decoder.buf.ReadByte()
+  if err != nil {
+    return 0, err
+  }
+  decoder.buf.UnreadByte()
+  return code, nil
 }
 
 func (decoder *Decoder) read() (byte, error) {
-  decoder.byteCount += 1
-	return decoder.buf.ReadByte()
+  if err := decoder.checkTotalBytes(1); err != nil {
+    return 0, err
+  }
+  var code byte
+  if len(decoder.pending) > 0 {
+    code = decoder.pending[0]
+    decoder.pending = decoder.pending[1:]
+  } else {
+    c, err := decoder.buf.ReadByte()
+    if err != nil {
+      return 0, err
+    }
+    code = c
+  }
+  decoder.offset++
+  if decoder.marked {
+    decoder.record = append(decoder.record, code)
+  }
+  return code, nil
 }
 
-func (decoder *Decoder) readn(n int) []byte {
-  bs := decoder.buf.Next(n)
-  l := len(bs)
-  decoder.byteCount += int32(l)
-  return bs
+// read exactly n bytes, io.ErrUnexpectedEOF is returned on short data
+func (decoder *Decoder) readn(n int) ([]byte, error) {
+  if err := decoder.checkTotalBytes(n); err != nil {
+    return nil, err
+  }
+  bs := make([]byte, n)
+  l := copy(bs, decoder.pending)
+  decoder.pending = decoder.pending[l:]
+  var err error
+  if l < n {
+    var m int
+    m, err = io.ReadFull(decoder.buf, bs[l:])
+    l += m
+  }
+  decoder.offset += int64(l)
+  if decoder.marked {
+    decoder.record = append(decoder.record, bs[:l]...)
+  }
+  if err != nil {
+    return bs, decoder.unexpectedEOF(err, fmt.Sprintf("%d bytes", n))
+  }
+  return bs, nil
 }
 
-func (decoder *Decoder) unread_n_byte(n int32) {
-  var i int32
-  for i = 0; i < n; i++ {
-    decoder.buf.UnreadByte()
+// give back bytes that were just read
+func (decoder *Decoder) unread(bs []byte) {
+  pending := make([]byte, 0, len(bs) + len(decoder.pending))
+  pending = append(pending, bs...)
+  decoder.pending = append(pending, decoder.pending...)
+  decoder.offset -= int64(len(bs))
+  if decoder.marked {
+    decoder.record = decoder.record[:len(decoder.record) - len(bs)]
   }
 }
 
-func (decoder *Decoder) unread_n_rune(n int32) {
-  var i int32
-  for i = 0; i < n; i++ {
-    decoder.buf.UnreadRune()
+// readChar reads one character of utf-8 data as utf-16 code units.
+// supplementary characters come as a 4-byte sequence or, as java writes them,
+// a 3-byte cesu-8 sequence per surrogate. C0 80 is java's encoding of U+0000
+func (decoder *Decoder) readChar(units []uint16) ([]uint16, error) {
+  offset := decoder.offset
+  b0, err := decoder.read()
+  if err != nil {
+    return units, err
+  }
+  var size int
+  var r rune
+  switch {
+  case b0 < 0x80:
+    return append(units, uint16(b0)), nil
+  case b0 >= 0xc0 && b0 <= 0xdf:
+    size, r = 2, rune(b0 & 0x1f)
+  case b0 >= 0xe0 && b0 <= 0xef:
+    size, r = 3, rune(b0 & 0x0f)
+  case b0 >= 0xf0 && b0 <= 0xf4:
+    size, r = 4, rune(b0 & 0x07)
+  default:
+    return units, &EncodingError{offset, fmt.Sprintf("invalid leading byte 0x%02x", b0)}
+  }
+  for i := 1; i < size; i++ {
+    b, err := decoder.read()
+    if err != nil {
+      return units, decoder.unexpectedEOF(err, "utf-8 data")
+    }
+    if b & 0xc0 != 0x80 {
+      decoder.unread([]byte{b})
+      return units, &EncodingError{offset, fmt.Sprintf("truncated %d-byte sequence", size)}
+    }
+    r = r<<6 | rune(b & 0x3f)
+  }
+  switch {
+  case size == 2 && r < 0x80 && r != 0, size == 3 && r < 0x800, size == 4 && r < 0x10000:
+    return units, &EncodingError{offset, fmt.Sprintf("overlong %d-byte sequence", size)}
+  case r > utf8.MaxRune:
+    return units, &EncodingError{offset, "code point above U+10FFFF"}
+  case size == 4:
+    r1, r2 := utf16.EncodeRune(r)
+    return append(units, uint16(r1), uint16(r2)), nil
   }
+  return append(units, uint16(r)), nil
 }
 
-func (decoder *Decoder) read_n_rune(n int) string {
-	if n == 0 {
-		return ""
-	}
-	var ret []rune
-	for {
-		r, _, err := decoder.buf.ReadRune()
-		if err != nil {
-			decoder.buf.UnreadRune()
-			break
-		}
-		ret = append(ret, r)
-		n--
-		if n <= 0 {
-			break
-		}
-	}
-  decoder.runeCount += int32(len(ret))
-	return string(ret)
+func isHighSurrogate(u uint16) bool {
+  return u >= 0xd800 && u <= 0xdbff
 }
 
-func (decoder *Decoder) readFixedLengthTypedValue(length int, typeName string) ([]interface{}, error) {
-  ret := []interface{}{}
+func isLowSurrogate(u uint16) bool {
+  return u >= 0xdc00 && u <= 0xdfff
+}
+
+// readChars reads n utf-16 code units, the length unit of hessian strings,
+// and appends them to units. a surrogate pair may be split between two
+// calls as java may split it between two string chunks
+func (decoder *Decoder) readChars(n int, units []uint16) ([]uint16, error) {
+  for count := 0; count < n; {
+    offset := decoder.offset
+    before := len(units)
+    var err error
+    units, err = decoder.readChar(units)
+    if err != nil {
+      return units, decoder.unexpectedEOF(err, "utf-8 data")
+    }
+    count += len(units) - before
+    if count > n {
+      return units, &EncodingError{offset, "supplementary character exceeds the string length"}
+    }
+    for i := before; i < len(units); i++ {
+      high := i > 0 && isHighSurrogate(units[i - 1])
+      if high && !isLowSurrogate(units[i]) {
+        return units, &EncodingError{offset, "high surrogate without low surrogate"}
+      }
+      if !high && isLowSurrogate(units[i]) {
+        return units, &EncodingError{offset, "low surrogate without high surrogate"}
+      }
+    }
+  }
+  return units, nil
+}
+
+// decodeChars returns the string of complete utf-16 data
+func (decoder *Decoder) decodeChars(units []uint16) (string, error) {
+  if len(units) > 0 && isHighSurrogate(units[len(units) - 1]) {
+    return "", &EncodingError{decoder.offset, "high surrogate without low surrogate"}
+  }
+  return string(utf16.Decode(units)), nil
+}
+
+// read_n_char reads a string of n utf-16 code units
+func (decoder *Decoder) read_n_char(n int) (string, error) {
+  if err := decoder.checkStringLen(n); err != nil {
+    return "", err
+  }
+  units, err := decoder.readChars(n, nil)
+  if err != nil {
+    return "", err
+  }
+  return decoder.decodeChars(units)
+}
+
+func (decoder *Decoder) readFixedLengthValue(length int) ([]interface{}, error) {
+  if err := decoder.checkListLen(length); err != nil {
+    return nil, err
+  }
+  ret := make([]interface{}, 0, preallocSize(length))
   for i := 0; i < length; i++ {
-    v, err := dynamic_call(decoder, typeName)
+    v, err := decoder.readValue()
     if err != nil {
-      fmt.Println(err)
-      return []interface{}{}, errors.New("readFixedLengthTypedValue: unexpected type value")
+      return []interface{}{}, decoder.unexpectedEOF(err, "value")
     }
     ret = append(ret, v)
   }
   return ret, nil
 }
 
-func (decoder *Decoder) readFixedLengthUnTypedValue(length int) ([]interface{}, error) {
+// read values until the terminating 'Z', 'z' in hessian 1.0
+func (decoder *Decoder) readVariableLengthValue() ([]interface{}, error) {
+  end := byte(0x5a)
+  if decoder.v1 {
+    end = 0x7a
+  }
   ret := []interface{}{}
-  for i := 0; i < length; i++ {
-    code, err := decoder.read()
+  for {
+    code, err := decoder.peek()
     if err != nil {
-      return []interface{}{}, err
+      return []interface{}{}, decoder.unexpectedEOF(err, "value or 'Z'")
+    }
+    if code == end {
+      decoder.read()
+      return ret, nil
+    }
+    if err := decoder.checkListLen(len(ret) + 1); err != nil {
+      return nil, err
     }
-    v, err := dynamic_call(decoder, CODE_TO_TYPE[code])
+    v, err := decoder.readValue()
     if err != nil {
-      return []interface{}{}, err
+      return []interface{}{}, decoder.unexpectedEOF(err, "value or 'Z'")
     }
     ret = append(ret, v)
   }
-  return ret, nil
 }
 
-func (decoder *Decoder) addRef(ref interface{}) {
-  decoder.refMap[decoder.refId] = ref
-  decoder.refId++
+// lists, maps and objects are numbered in the order they start, for x51 refs
+func (decoder *Decoder) addRef(ref interface{}) error {
+  refId := decoder.refId
+  if err := decoder.countRef(); err != nil {
+    return err
+  }
+  decoder.refMap[refId] = ref
+  return nil
 }
 
 func (decoder *Decoder) ReadInt() (int32, error) {
@@ -142,51 +411,45 @@ func (decoder *Decoder) ReadInt() (int32, error) {
 		return 0, err
 	}
 	if code == 0x49 {
-		bits := decoder.readn(4)
-		if len(bits) < 4 {
-			return 0, errors.New("readInt error: unexpected length of bytes")
+		bits, err := decoder.readn(4)
+		if err != nil {
+			return 0, err
 		}
-    decoder.success()
 		return parseInt32FromBytes(bits), nil
 	}
 	if code >= 0x80 && code <= 0xbf {
-    decoder.success()
 		return int32(int8(code - 0x90)), nil
 	}
 	if code >= 0xc0 && code <= 0xcf {
 		b0, err := decoder.read()
 		if err != nil {
-			return 0, err
+			return 0, decoder.unexpectedEOF(err, "1 bytes")
 		}
-    decoder.success()
 		return parseInt32(int8(code-0xc8), []byte{b0}), nil
 	}
 	if code >= 0xd0 && code <= 0xd7 {
-		bits := decoder.readn(2)
-		if len(bits) < 2 {
-			return 0, errors.New("readInt error: unexpected length of bytes")
+		bits, err := decoder.readn(2)
+		if err != nil {
+			return 0, err
 		}
-    decoder.success()
 		return parseInt32(int8(code-0xd4), bits), nil
 	}
 	// throw error
-	return 0, errors.New("readInt error: " + string(code))
+	return 0, decoder.syntaxError(decoder.offset - 1, code, "int")
 }
 
-func (decoder Decoder) ReadBoolean() (bool, error) {
+func (decoder *Decoder) ReadBoolean() (bool, error) {
 	code, err := decoder.read()
 	if err != nil {
 		return false, err
 	}
 	switch code {
 	case 0x54:
-    decoder.success()
 		return true, nil
 	case 0x46:
-    decoder.success()
 		return false, nil
 	default:
-		return false, errors.New("readBoolean error: unexpected code, 'T' or 'F' expected")
+		return false, decoder.syntaxError(decoder.offset - 1, code, "bool")
 	}
 }
 
@@ -195,122 +458,117 @@ func (decoder Decoder) ReadBoolean() (bool, error) {
  *        ::= S b1 b0 <utf8-data>
  *        ::= [x00-x1f] <utf8-data>
  *        ::= [x30-x33] b0 <utf8-data>
+ * hessian 1.0:
+ * string ::= s b1 b0 <utf8-data> string
+ *        ::= S b1 b0 <utf8-data>
+ * xml is read as string, with x and X chunks
  */
 func (decoder *Decoder) ReadString() (string, error) {
-	code, err := decoder.read()
-	if err != nil {
-		return "", err
-	}
-	switch {
-	case code == 0x53:
-		// final chunk
-		decoder.lastChunk = true
-		bits := decoder.readn(2)
-		size := int(bits[0]<<8 + bits[1])
-		ret := decoder.read_n_rune(size)
-		if len(ret) < size {
-			return "", errors.New("readString error: unexpected length")
-		}
-    decoder.success()
-		return ret, nil
-	case code == 0x52:
-		bits := decoder.readn(2)
-		size := int(bits[0]<<8 + bits[1])
-		ret := decoder.read_n_rune(size)
-		if len(ret) < size {
-			return "", errors.New("readString error: unexpected length")
-		}
-		for !decoder.lastChunk {
-			chunk, err := decoder.ReadString()
-			if err != nil {
-				return "", err
-			}
-			ret += chunk
-		}
-		decoder.lastChunk = false
-    decoder.success()
-		return ret, nil
-	case code >= 0x00 && code <= 0x1f:
-		size := int(code)
-		ret := decoder.read_n_rune(size)
-		if len(ret) < size {
-			return "", errors.New("readString error: unexpected length")
-		}
-    decoder.success()
-		return ret, nil
-	case code >= 0x30 && code <= 0x33:
-		bits := decoder.readn(1)
-		if len(bits) < 1 {
-			return "", errors.New("readString error: unexpected length")
-		}
-		size := int((code-0x30)<<8 + bits[0])
-		ret := decoder.read_n_rune(size)
-		if len(ret) < size {
-			return "", errors.New("readString error: unexpected length")
-		}
-    decoder.success()
-		return ret, nil
-	default:
-		return "", errors.New("readString error: unexpected code")
-	}
+  var units []uint16
+  for first := true; ; first = false {
+    code, err := decoder.read()
+    if err != nil {
+      if !first {
+        err = decoder.unexpectedEOF(err, "string chunk")
+      }
+      return "", err
+    }
+    final := true
+    var size int
+    switch {
+    case decoder.v1 && (code == 0x53 || code == 0x73 || code == 0x58 || code == 0x78):
+      final = code == 0x53 || code == 0x58
+      bits, err := decoder.readn(2)
+      if err != nil {
+        return "", err
+      }
+      size = int(bits[0])<<8 + int(bits[1])
+    case decoder.v1:
+      return "", decoder.syntaxError(decoder.offset - 1, code, "string")
+    case code == 0x52 || code == 0x53:
+      // 'R' is a non-final chunk, 'S' the final one
+      final = code == 0x53
+      bits, err := decoder.readn(2)
+      if err != nil {
+        return "", err
+      }
+      size = int(bits[0])<<8 + int(bits[1])
+    case code >= 0x00 && code <= 0x1f:
+      size = int(code)
+    case code >= 0x30 && code <= 0x33:
+      bits, err := decoder.readn(1)
+      if err != nil {
+        return "", err
+      }
+      size = int(code-0x30)<<8 + int(bits[0])
+    default:
+      return "", decoder.syntaxError(decoder.offset - 1, code, "string")
+    }
+    // the size counts utf-16 code units like java string lengths
+    if err := decoder.checkStringLen(len(units) + size); err != nil {
+      return "", err
+    }
+    units, err = decoder.readChars(size, units)
+    if err != nil {
+      return "", err
+    }
+    if final {
+      return decoder.decodeChars(units)
+    }
+  }
 }
 
 /**
- * binary ::= b b1 b0 <binary-data> binary
+ * binary ::= x41 b1 b0 <binary-data> binary
+ *        ::= b b1 b0 <binary-data> binary
  *        ::= B(final_chunk) b1 b0 <binary-data>
  *        ::= [x20-x2f] <binary-data>
+ *        ::= [x34-x37] b0 <binary-data>
  */
 func (decoder *Decoder) ReadBinary() ([]byte, error) {
-	code, err := decoder.read()
-	if err != nil {
-		return nil, errors.New("readBinary error: unexpected code")
-	}
-	switch {
-	case code == 0x62:
-		bits := decoder.readn(2)
-		if len(bits) < 2 {
-			return nil, errors.New("readBinary error: unexpected length")
-		}
-		size := int(bits[0]<<8 + bits[1])
-		ret := decoder.readn(size)
-		if len(ret) < size {
-			return nil, errors.New("readBinary error: unexpected length")
-		}
-		for !decoder.lastChunk {
-			chunk, err := decoder.ReadBinary()
-			if err != nil {
-				return nil, err
-			}
-			ret = append(ret, chunk...)
-		}
-		// reset
-		decoder.lastChunk = false
-    decoder.success()
-		return ret, nil
-	case code == 0x42 /*B*/ :
-		decoder.lastChunk = true
-		bits := decoder.readn(2)
-		if len(bits) < 2 {
-			return nil, errors.New("readBinary error: unexpected length")
-		}
-		size := int(bits[0]<<8 + bits[1])
-		bits = decoder.readn(size)
-		if len(bits) < size {
-			return nil, errors.New("readBinary error: unexpected length")
-		}
-    decoder.success()
-		return bits, nil
-	case code >= 0x20 && code <= 0x2f:
-		size := int(code - 0x20)
-		ret := decoder.readn(size)
-		if len(ret) < size {
-			return nil, errors.New("readBinary error: unexpected length")
-		}
-    decoder.success()
-		return ret, nil
-	default:
-		return nil, errors.New("readBinary error: unexpected code")
-	}
+  ret := []byte{}
+  for first := true; ; first = false {
+    code, err := decoder.read()
+    if err != nil {
+      if !first {
+        err = decoder.unexpectedEOF(err, "binary chunk")
+      }
+      return nil, err
+    }
+    final := true
+    var size int
+    switch {
+    case code == 0x41 || code == 0x62 || code == 0x42:
+      // 'A' (and 'b' as in hessian 1.0) is a non-final chunk, 'B' the final one
+      final = code == 0x42
+      bits, err := decoder.readn(2)
+      if err != nil {
+        return nil, err
+      }
+      size = int(bits[0])<<8 + int(bits[1])
+    case code >= 0x20 && code <= 0x2f:
+      size = int(code - 0x20)
+    case code >= 0x34 && code <= 0x37:
+      bits, err := decoder.readn(1)
+      if err != nil {
+        return nil, err
+      }
+      size = int(code-0x34)<<8 + int(bits[0])
+    default:
+      return nil, decoder.syntaxError(decoder.offset - 1, code, "binary")
+    }
+    if err := decoder.checkBinaryLen(len(ret) + size); err != nil {
+      return nil, err
+    }
+    chunk, err := decoder.readn(size)
+    if err != nil {
+      return nil, err
+    }
+    ret = append(ret, chunk...)
+    if final {
+      return ret, nil
+    }
+  }
 }
 
 /**
@@ -321,44 +579,40 @@ func (decoder *Decoder) ReadBinary() ([]byte, error) {
  *      ::= x4c b3 b2 b1 b0 // hessian 2 java use 0x59, hessian 3 use 0x77
  * here we use 0x59
  */
-func (decoder Decoder) ReadLong() (int64, error) {
+func (decoder *Decoder) ReadLong() (int64, error) {
 	code, err := decoder.read()
 	if err != nil {
 		return -1, err
 	}
 	switch {
 	case code == 0x4c /*L*/ :
-		bits := decoder.readn(8)
-		if len(bits) < 8 {
-			return -1, errors.New("readLong error: unexpected length")
+		bits, err := decoder.readn(8)
+		if err != nil {
+			return -1, err
 		}
-    decoder.success()
 		return parseInt64FromBytes(bits), nil
 	case code >= 0xd8 && code <= 0xef:
     return parseInt64(int8(code-0xe0), []byte{}), nil
 	case code >= 0xf0 && code <= 0xff:
-		bits := decoder.readn(1)
-		if len(bits) < 1 {
-			return -1, errors.New("readLong error: unexpected length")
+		bits, err := decoder.readn(1)
+		if err != nil {
+			return -1, err
 		}
-    decoder.success()
 		return parseInt64(int8(code-0xf8), bits), nil
 	case code >= 0x38 && code <= 0x3f:
-		bits := decoder.readn(2)
-		if len(bits) < 2 {
-			return -1, errors.New("readLong error: unexpected length")
+		bits, err := decoder.readn(2)
+		if err != nil {
+			return -1, err
 		}
-    decoder.success()
 		return parseInt64(int8(code-0x3c), bits), nil
 	case code == 0x59:
-		bits := decoder.readn(4)
-		if len(bits) < 4 {
-			return -1, errors.New("readLong error: unexpected length")
+		bits, err := decoder.readn(4)
+		if err != nil {
+			return -1, err
 		}
-    decoder.success()
-		return parseInt64FromBytes(bits), nil
+		return int64(parseInt32FromBytes(bits)), nil
 	}
-	return -1, errors.New("readLong error: unexpected code")
+	return -1, decoder.syntaxError(decoder.offset - 1, code, "long")
 }
 
 /**
@@ -369,75 +623,72 @@ func (decoder Decoder) ReadLong() (int64, error) {
  *          ::= x5e b1 b0
  *          ::= x5f b3 b2 b1 b0
  */
-func (decoder Decoder) ReadDouble() (float64, error) {
+func (decoder *Decoder) ReadDouble() (float64, error) {
 	code, err := decoder.read()
 	if err != nil {
 		return -1, err
 	}
 	switch {
 	case code == 0x44:
-		bits := decoder.readn(8)
-		if len(bits) < 8 {
-			return 0.0, errors.New("readDouble: unexpected length")
+		bits, err := decoder.readn(8)
+		if err != nil {
+			return 0.0, err
 		}
-    decoder.success()
 		return parseFloat64FromBytes(bits), nil
 	case code == 0x5b:
-    decoder.success()
 		return 0.0, nil
 	case code == 0x5c:
-    decoder.success()
 		return 1.0, nil
 	case code == 0x5d:
-		bits := decoder.readn(1)
-		if len(bits) < 1 {
-			return 0.0, errors.New("readDouble: unexpected length")
+		bits, err := decoder.readn(1)
+		if err != nil {
+			return 0.0, err
 		}
-    decoder.success()
 		return float64(int8(bits[0])), nil
 	case code == 0x5e:
-		bits := decoder.readn(2)
-		if len(bits) < 2 {
-			return 0.0, errors.New("readDouble: unexpected length")
+		bits, err := decoder.readn(2)
+		if err != nil {
+			return 0.0, err
 		}
-    decoder.success()
 		return float64(parseInt16(int8(bits[0]), bits[1])), nil
 	case code == 0x5f:
-		bits := decoder.readn(4)
-		if len(bits) < 4 {
-			return 0.0, errors.New("readDouble: unexpected length")
+		bits, err := decoder.readn(4)
+		if err != nil {
+			return 0.0, err
 		}
-    decoder.success()
-		return float64(parseFloat32FromBytes(bits)), nil
+    // same as java Hessian2Input: the int is the value in thousandths
+		return 0.001 * float64(parseInt32FromBytes(bits)), nil
 	default:
-		return 0.0, errors.New("readDouble: unexpected length")
+		return 0.0, decoder.syntaxError(decoder.offset - 1, code, "double")
 	}
 }
 
-func (decoder Decoder) ReadDate() (time.Time, error) {
+func (decoder *Decoder) ReadDate() (time.Time, error) {
 	code, err := decoder.read()
   if err != nil {
     return TIME_DEFAULT_VALUE, err
   }
+  if decoder.v1 && code == 0x64 {
+    // 'd' of hessian 1.0 holds the milliseconds like x4a
+    code = 0x4a
+  }
   switch code {
   case 0x4a:
-    bits := decoder.readn(8)
-    if len(bits) < 8 {
-      return TIME_DEFAULT_VALUE, errors.New("readDate: unexpected length")
+    bits, err := decoder.readn(8)
+    if err != nil {
+      return TIME_DEFAULT_VALUE, err
     }
-    decoder.success()
     ms := parseInt64FromBytes(bits)
     return time.Unix(ms / 1000, (ms % 1000) * 1e6), nil
   case 0x4b:
-    bits := decoder.readn(4)
-    if len(bits) < 4 {
-      return TIME_DEFAULT_VALUE, errors.New("readDate: unexpected length")
+    bits, err := decoder.readn(4)
+    if err != nil {
+      return TIME_DEFAULT_VALUE, err
     }
-    decoder.success()
-    minutes := parseInt64FromBytes(bits)
+    minutes := int64(parseInt32FromBytes(bits))
     return time.Unix(minutes * 60, 0), nil
   default:
-    return TIME_DEFAULT_VALUE, errors.New("readDate: unexpected code")
+    return TIME_DEFAULT_VALUE, decoder.syntaxError(decoder.offset - 1, code, "date")
   }
 }
 
@@ -447,32 +698,34 @@ func (decoder *Decoder) ReadNull() (interface{}, error) {
     return nil, err
   }
   if code == 0x4e {
-    decoder.success()
     return nil, nil
   }
-  return nil, errors.New("readNull: unexpected code")
+  return nil, decoder.syntaxError(decoder.offset - 1, code, "null")
 }
 
 /**
  * ref :: = x51 int
  */
 func (decoder *Decoder) ReadRef() (interface{}, error){
+  if decoder.v1 {
+    return decoder.readRefV1()
+  }
   code, err := decoder.read()
   if err != nil {
     return nil, err
   }
   if code != 0x51 {
-    return nil, errors.New("readRef: unexpected code")
+    return nil, decoder.syntaxError(decoder.offset - 1, code, "ref")
   }
+  offset := decoder.offset
   refId, err := decoder.ReadInt()
   if err != nil {
-    return nil, err
+    return nil, decoder.unexpectedEOF(err, "ref")
   }
   ret, ok := decoder.refMap[refId]
   if !ok {
-    return nil, errors.New("readRef: unexpected ref")
+    return nil, &ReferenceError{offset, "ref", refId}
   }
-  decoder.success()
   return ret, nil
 }
 
@@ -481,27 +734,38 @@ func (decoder *Decoder) ReadRef() (interface{}, error){
  *      ::= int(type-ref)
  */
 func (decoder *Decoder) ReadType() (string, error) {
-  s, err := decoder.ReadString()
+  if decoder.v1 {
+    return decoder.readTypeV1()
+  }
+  code, err := decoder.peek()
   if err != nil {
-    decoder.Recover()
-    refId, err := decoder.ReadInt()
+    return "", err
+  }
+  if CODE_TO_TYPE[code] == "string" {
+    offset := decoder.offset
+    s, err := decoder.ReadString()
     if err != nil {
-      return "", errors.New("readType: unexpected code")
-    }
-    ref, ok := decoder.refMap[refId]
-    if !ok {
-      return "", errors.New("readType: unknown type")
+      return "", err
     }
-    stringType, ok := ref.(string) // assertion
-    if !ok {
-      return "", errors.New("readType: unknown type")
+    if err := decoder.checkClass(offset, s); err != nil {
+      return "", err
     }
-    decoder.success()
-    return stringType, nil
+    decoder.types = append(decoder.types, s)
+    return s, nil
   }
-  decoder.addRef(s)
-  decoder.success()
-  return s, nil
+  offset := decoder.offset
+  if CODE_TO_TYPE[code] != "int" {
+    decoder.read()
+    return "", decoder.syntaxError(offset, code, "type")
+  }
+  refId, err := decoder.ReadInt()
+  if err != nil {
+    return "", decoder.unexpectedEOF(err, "type")
+  }
+  if refId < 0 || int(refId) >= len(decoder.types) {
+    return "", &ReferenceError{offset, "type", refId}
+  }
+  return decoder.types[refId], nil
 }
 
 /**
@@ -513,164 +777,587 @@ list ::= x55 type value* 'Z'   # variable-length list
      ::= [x78-7f] value*       # fixed-length untyped list
 */
 func (decoder *Decoder) ReadList() (List, error) {
-  code, err := decoder.read()
+  ret, err := decoder.readList()
   if err != nil {
     return List{}, err
   }
+  return *ret, nil
+}
+
+// the list is registered as ref before its values are read,
+// so values can refer back to it
+func (decoder *Decoder) readList() (*List, error) {
+  ret, size, err := decoder.readListHeader()
+  if err != nil {
+    return nil, err
+  }
+  return decoder.readListValues(ret, size)
+}
+
+func (decoder *Decoder) readListValues(ret *List, size int) (*List, error) {
+  err := decoder.addRef(ret)
+  if err != nil {
+    return nil, err
+  }
+  if size < 0 {
+    ret.Value, err = decoder.readVariableLengthValue()
+  } else {
+    ret.Value, err = decoder.readFixedLengthValue(size)
+  }
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "list")
+  }
+  return ret, nil
+}
+
+// readListHeader reads the list up to its first value, it returns
+// the list without values and its size, -1 if it ends with 'Z'
+func (decoder *Decoder) readListHeader() (*List, int, error) {
+  if decoder.v1 {
+    return decoder.readListHeaderV1()
+  }
+  code, err := decoder.read()
+  if err != nil {
+    return nil, 0, err
+  }
+  ret := &List{ValueType: UNTYPED}
+  size := -1 // variable-length
   switch {
-  case code == 0x55:
+  case code == 0x55 || code == 0x56 || code >= 0x70 && code <= 0x77:
     parsedType, err := decoder.ReadType()
     if err != nil {
-      return List{}, err
+      return nil, 0, decoder.unexpectedEOF(err, "list")
     }
-    listValue := []interface{}{}
-    for {
-      v, err := dynamic_call(decoder, parsedType)
-      listValue := append(listValue, v)
+    ret.ValueType = parsedType
+    if code >= 0x70 {
+      size = int(code - 0x70)
+    }
+    if code == 0x56 {
+      n, err := decoder.ReadInt()
       if err != nil {
-        decoder.Recover()
-        end, err := decoder.read()
-        if err != nil || end != 0x5a /*Z*/ {
-          return List{}, errors.New("readList: unexpected code")
-        } else {
-          return List{
-            ValueType: parsedType,
-            Value: listValue,
-          }, nil
-        }
+        return nil, 0, decoder.unexpectedEOF(err, "list")
       }
+      size = int(n)
     }
-  case code == 0x56:
-    parsedType, err := decoder.ReadType()
+  case code == 0x57:
+  case code == 0x58:
+    n, err := decoder.ReadInt()
     if err != nil {
-      return List{}, err
+      return nil, 0, decoder.unexpectedEOF(err, "list")
     }
-    size, err := decoder.ReadInt()
-    if err != nil {
-      return List{}, err
+    size = int(n)
+  case code >= 0x78 && code <= 0x7f:
+    size = int(code - 0x78)
+  default:
+    return nil, 0, decoder.syntaxError(decoder.offset - 1, code, "list")
+  }
+  // only 'U' and 'W' lists end with 'Z'
+  if size < 0 && code != 0x55 && code != 0x57 {
+    return nil, 0, fmt.Errorf("hessian: negative list length %d at offset %d: %w", size, decoder.offset, ErrSyntax)
+  }
+  if err := decoder.checkListLen(size); err != nil {
+    return nil, 0, err
+  }
+  return ret, size, nil
+}
+
+// readListValue reads a list like readList, except that lists of java
+// primitive arrays like [int and [double are returned as go slices like
+// []int32 and []float64, without boxing each value
+func (decoder *Decoder) readListValue() (interface{}, error) {
+  ret, size, err := decoder.readListHeader()
+  if err != nil {
+    return nil, err
+  }
+  if !isPrimitiveList(ret.ValueType) {
+    return decoder.readListValues(ret, size)
+  }
+  // the ref is taken before the values, the slice is known after them
+  id := decoder.refId
+  if err := decoder.addRef(nil); err != nil {
+    return nil, err
+  }
+  values, err := decoder.readPrimitiveList(ret.ValueType, size)
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "list")
+  }
+  decoder.refMap[id] = values
+  return values, nil
+}
+
+func isPrimitiveList(valueType string) bool {
+  switch valueType {
+  case "[boolean", "[byte", "[short", "[int", "[long", "[float", "[double", "[string", "[java.lang.String":
+    return true
+  }
+  return false
+}
+
+// hasNextValue reports whether the i-th value of a list of size follows,
+// it reads the 'Z' that ends a variable-length list
+func (decoder *Decoder) hasNextValue(size, i int) (bool, error) {
+  if size >= 0 {
+    return i < size, nil
+  }
+  end := byte(0x5a)
+  if decoder.v1 {
+    end = 0x7a
+  }
+  code, err := decoder.peek()
+  if err != nil {
+    return false, err
+  }
+  if code == end {
+    decoder.read()
+    return false, nil
+  }
+  return true, nil
+}
+
+// readPrimitiveList reads the values of a list of a java primitive array
+// type into a go slice. null strings in a string array are read as ""
+func (decoder *Decoder) readPrimitiveList(valueType string, size int) (interface{}, error) {
+  capacity := preallocSize(size)
+  var next func() error
+  var values func() interface{}
+  switch valueType {
+  case "[boolean":
+    ret := make([]bool, 0, capacity)
+    next = func() error {
+      v, err := decoder.ReadBoolean()
+      ret = append(ret, v)
+      return err
     }
-    listValue, err := decoder.readFixedLengthTypedValue(int(size), parsedType)
-    if err != nil {
-      return List{}, err
+    values = func() interface{} { return ret }
+  case "[byte":
+    ret := make([]int8, 0, capacity)
+    next = func() error {
+      v, err := decoder.ReadInt()
+      ret = append(ret, int8(v))
+      return err
     }
-    return List{parsedType, listValue}, nil
-  case code == 0x58:
-    size, err := decoder.ReadInt()
-    if err != nil {
-      return List{}, err
+    values = func() interface{} { return ret }
+  case "[short":
+    ret := make([]int16, 0, capacity)
+    next = func() error {
+      v, err := decoder.ReadInt()
+      ret = append(ret, int16(v))
+      return err
     }
-    listValue, err := decoder.readFixedLengthUnTypedValue(int(size))
-    if err != nil {
-      return List{}, err
-    }
-    return List{
-      ValueType: UNTYPED,
-      Value: listValue,
-    }, nil
-  case code >= 0x70 && code <= 0x77:
-    size := int(code - 0x70)
-    parsedType, err := decoder.ReadType()
-    if err != nil {
-      return List{}, err
+    values = func() interface{} { return ret }
+  case "[int":
+    ret := make([]int32, 0, capacity)
+    next = func() error {
+      v, err := decoder.ReadInt()
+      ret = append(ret, v)
+      return err
+    }
+    values = func() interface{} { return ret }
+  case "[long":
+    ret := make([]int64, 0, capacity)
+    next = func() error {
+      v, err := decoder.ReadLong()
+      ret = append(ret, v)
+      return err
+    }
+    values = func() interface{} { return ret }
+  case "[float":
+    ret := make([]float32, 0, capacity)
+    next = func() error {
+      v, err := decoder.ReadDouble()
+      ret = append(ret, float32(v))
+      return err
     }
-    ret := List{
-      ValueType: parsedType[1:],
-      Value: []interface{}{},
+    values = func() interface{} { return ret }
+  case "[double":
+    ret := make([]float64, 0, capacity)
+    next = func() error {
+      v, err := decoder.ReadDouble()
+      ret = append(ret, v)
+      return err
     }
-    listValue, err := decoder.readFixedLengthTypedValue(size, parsedType[1:])
+    values = func() interface{} { return ret }
+  default: // [string
+    ret := make([]string, 0, capacity)
+    next = func() error {
+      if code, err := decoder.peek(); err == nil && code == 0x4e {
+        decoder.read()
+        ret = append(ret, "")
+        return nil
+      }
+      v, err := decoder.ReadString()
+      ret = append(ret, v)
+      return err
+    }
+    values = func() interface{} { return ret }
+  }
+  for i := 0; ; i++ {
+    more, err := decoder.hasNextValue(size, i)
     if err != nil {
-      return List{}, err
+      return nil, err
+    }
+    if !more {
+      return values(), nil
+    }
+    if err := decoder.checkListLen(i + 1); err != nil {
+      return nil, err
+    }
+    if err := next(); err != nil {
+      return nil, err
     }
-    ret.Value = listValue
-    return ret, nil
   }
-  return List{}, nil
 }
 
 // read untyped map
 func (decoder *Decoder) ReadMap() (map[interface{}]interface{}, error) {
+  if decoder.v1 {
+    v, err := decoder.readMapV1()
+    if err != nil {
+      return nil, err
+    }
+    return mapEntries(v), nil
+  }
   code, err := decoder.read()
   if err != nil {
     return nil, err
   }
   if code != 0x48 {
-    return nil, errors.New("decoder ReadMap: unexpected error")
+    return nil, decoder.syntaxError(decoder.offset - 1, code, "map")
   }
   ret := map[interface{}]interface{}{}
+  if err := decoder.addRef(ret); err != nil {
+    return nil, err
+  }
   for {
-    code, err = decoder.read()
+    code, err = decoder.peek()
     if err != nil {
-      return nil, err
+      return nil, decoder.unexpectedEOF(err, "map entry or 'Z'")
     }
     if code == 0x5a {
+      decoder.read()
       break
     }
-    keyType := CODE_TO_TYPE[code]
-    decoder.unread_n_byte(1)
-    key, err := dynamic_call(decoder, keyType)
-    if err != nil {
+    if err := decoder.checkListLen(len(ret) + 1); err != nil {
       return nil, err
     }
-    code, err = decoder.read()
+    key, err := decoder.ReadValue()
     if err != nil {
-      return nil, err
+      return nil, decoder.unexpectedEOF(err, "map entry or 'Z'")
+    }
+    if key != nil && !reflect.TypeOf(key).Comparable() {
+      return nil, fmt.Errorf("hessian: unhashable map key %T at offset %d: %w", key, decoder.offset, ErrSyntax)
     }
-    valueType := CODE_TO_TYPE[code]
-    decoder.unread_n_byte(1)
-    value, err := dynamic_call(decoder, valueType)
+    value, err := decoder.ReadValue()
     if err != nil {
-      return nil, err
+      return nil, decoder.unexpectedEOF(err, "map entry or 'Z'")
     }
     ret[key] = value
   }
   return ret, nil
 }
 
+// ReadTypedMap reads a typed map with string keys, like the maps written
+// for java beans. ReadValue reads typed maps with other keys as well
 func (decoder *Decoder) ReadTypedMap() (TypedMap, error){
-  code, err := decoder.read()
+  offset := decoder.offset
+  v, err := decoder.readTypedMap()
   if err != nil {
     return emptyTypedMap, err
   }
+  ret, ok := v.(*TypedMap)
+  if !ok {
+    return emptyTypedMap, fmt.Errorf("hessian: typed map at offset %d has keys that are not strings", offset)
+  }
+  return *ret, nil
+}
+
+// readTypedMap returns the map as *TypedMap, or as map[interface{}]interface{}
+// if it has a key that is not a string
+func (decoder *Decoder) readTypedMap() (interface{}, error) {
+  code, err := decoder.read()
+  if err != nil {
+    return nil, err
+  }
   if code != 0x4d {
-    return emptyTypedMap, errors.New("decoder ReadMap: unexpected error")
+    return nil, decoder.syntaxError(decoder.offset - 1, code, "typed map")
   }
-  ret := TypedMap{}
-  typeName, err := decoder.ReadString()
+  if decoder.v1 {
+    typeName, err := decoder.readTypeV1()
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "map")
+    }
+    if typeName == "" {
+      return nil, decoder.syntaxError(decoder.offset - 1, code, "typed map")
+    }
+    return decoder.readMapEntriesV1(typeName, true)
+  }
+  typeName, err := decoder.ReadType()
   if err != nil {
-    return emptyTypedMap, err
+    return nil, decoder.unexpectedEOF(err, "map entry or 'Z'")
+  }
+  entries, err := decoder.newTypedMapEntries(typeName, true)
+  if err != nil {
+    return nil, err
   }
-  ret.ValueType = typeName
-  ret.Value = map[string]interface{}{}
   for {
-    code, err := decoder.read()
+    code, err := decoder.peek()
     if err != nil {
-      return emptyTypedMap, err
+      return nil, decoder.unexpectedEOF(err, "map entry or 'Z'")
     }
     if code == 0x5a {
+      decoder.read()
       break
     }
-    decoder.unread_n_byte(1)
-    propertyName, err := decoder.ReadString()
+    if err := decoder.checkListLen(entries.len() + 1); err != nil {
+      return nil, err
+    }
+    offset := decoder.offset
+    key, err := decoder.ReadValue()
     if err != nil {
-      return emptyTypedMap, err
+      return nil, decoder.unexpectedEOF(err, "map entry or 'Z'")
     }
-    code, err = decoder.read()
+    value, err := decoder.ReadValue()
     if err != nil {
-      return emptyTypedMap, err
+      return nil, decoder.unexpectedEOF(err, "map entry or 'Z'")
     }
-    valueType := CODE_TO_TYPE[code]
-    decoder.unread_n_byte(1)
-    value, err := dynamic_call(decoder, valueType)
+    if err := decoder.putTypedMapEntry(entries, offset, key, value); err != nil {
+      return nil, err
+    }
+  }
+  return entries.value(), nil
+}
+
+// typedMapEntries collects the entries of a typed map. java writes maps like
+// HashMap<Integer, V> with their class name too, once a key is not a string
+// the entries are moved to an untyped map
+type typedMapEntries struct {
+  typed *TypedMap
+  untyped map[interface{}]interface{}
+  refId int32 // -1 if the map is not numbered for refs
+}
+
+func (decoder *Decoder) newTypedMapEntries(typeName string, ref bool) (*typedMapEntries, error) {
+  entries := &typedMapEntries{
+    typed: &TypedMap{ValueType: typeName, Value: map[string]interface{}{}},
+    refId: -1,
+  }
+  if ref {
+    entries.refId = decoder.refId
+    if err := decoder.addRef(entries.typed); err != nil {
+      return nil, err
+    }
+  }
+  return entries, nil
+}
+
+func (entries *typedMapEntries) len() int {
+  if entries.untyped != nil {
+    return len(entries.untyped)
+  }
+  return len(entries.typed.Value)
+}
+
+func (entries *typedMapEntries) value() interface{} {
+  if entries.untyped != nil {
+    return entries.untyped
+  }
+  return entries.typed
+}
+
+// putTypedMapEntry adds the entry read at offset, refs to the map read
+// after its keys turned untyped resolve to the untyped map
+func (decoder *Decoder) putTypedMapEntry(entries *typedMapEntries, offset int64, key, value interface{}) error {
+  if name, ok := key.(string); ok && entries.untyped == nil {
+    entries.typed.Value[name] = value
+    return nil
+  }
+  if key != nil && !reflect.TypeOf(key).Comparable() {
+    return fmt.Errorf("hessian: unhashable map key %T at offset %d: %w", key, offset, ErrSyntax)
+  }
+  if entries.untyped == nil {
+    entries.untyped = make(map[interface{}]interface{}, len(entries.typed.Value) + 1)
+    for name, item := range entries.typed.Value {
+      entries.untyped[name] = item
+    }
+    if entries.refId >= 0 {
+      decoder.refMap[entries.refId] = entries.untyped
+    }
+  }
+  entries.untyped[key] = value
+  return nil
+}
+
+/**
+ * class-def ::= 'C' string int string*
+ */
+func (decoder *Decoder) ReadClassDef() (ClassDef, error) {
+  code, err := decoder.read()
+  if err != nil {
+    return ClassDef{}, err
+  }
+  if code != 0x43 {
+    return ClassDef{}, decoder.syntaxError(decoder.offset - 1, code, "class definition")
+  }
+  offset := decoder.offset
+  name, err := decoder.ReadString()
+  if err != nil {
+    return ClassDef{}, decoder.unexpectedEOF(err, "class definition")
+  }
+  if err := decoder.checkClass(offset, name); err != nil {
+    return ClassDef{}, err
+  }
+  size, err := decoder.ReadInt()
+  if err != nil {
+    return ClassDef{}, decoder.unexpectedEOF(err, "class definition")
+  }
+  if size < 0 {
+    return ClassDef{}, fmt.Errorf("hessian: negative field count %d at offset %d: %w", size, decoder.offset, ErrSyntax)
+  }
+  if err := decoder.checkListLen(int(size)); err != nil {
+    return ClassDef{}, err
+  }
+  ret := ClassDef{
+    ValueType: name,
+    Fields: make([]string, 0, preallocSize(int(size))),
+  }
+  for i := int32(0); i < size; i++ {
+    field, err := decoder.ReadString()
     if err != nil {
-      return emptyTypedMap, err
+      return ClassDef{}, decoder.unexpectedEOF(err, "class definition")
     }
-    ret.Value[propertyName] = value
+    ret.Fields = append(ret.Fields, field)
   }
+  decoder.classDefs = append(decoder.classDefs, ret)
   return ret, nil
 }
 
+/**
+ * object ::= 'O' int value*
+ *        ::= [x60-x6f] value*
+ * class definitions before the instance are read as well
+ */
+func (decoder *Decoder) ReadObject() (Object, error) {
+  ret, err := decoder.readObject()
+  if err != nil {
+    return Object{}, err
+  }
+  return *ret, nil
+}
+
+func (decoder *Decoder) readObject() (*Object, error) {
+  code, err := decoder.peek()
+  if err != nil {
+    return nil, err
+  }
+  for code == 0x43 {
+    if _, err := decoder.ReadClassDef(); err != nil {
+      return nil, err
+    }
+    code, err = decoder.peek()
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "object")
+    }
+  }
+  offset := decoder.offset
+  decoder.read()
+  var defId int32
+  switch {
+  case code == 0x4f:
+    defId, err = decoder.ReadInt()
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "object")
+    }
+  case code >= 0x60 && code <= 0x6f:
+    defId = int32(code - 0x60)
+  default:
+    return nil, decoder.syntaxError(offset, code, "object")
+  }
+  if defId < 0 || int(defId) >= len(decoder.classDefs) {
+    return nil, &ReferenceError{offset, "class definition", defId}
+  }
+  def := decoder.classDefs[defId]
+  ret := &Object{
+    ValueType: def.ValueType,
+    Fields: def.Fields,
+  }
+  if err := decoder.addRef(ret); err != nil {
+    return nil, err
+  }
+  ret.Value, err = decoder.readFixedLengthValue(len(def.Fields))
+  if err != nil {
+    return nil, err
+  }
+  return ret, nil
+}
+
+// ReadValue decodes the next value of any type, the type is chosen by
+// the leading byte. lists, typed maps and objects are returned as *List,
+// *TypedMap and *Object, or as go values for classes registered by RegisterType.
+// lists of java primitive arrays are returned as go slices like []int32
+func (decoder *Decoder) ReadValue() (interface{}, error) {
+  v, err := decoder.readValue()
+  if err != nil || decoder.depth > 0 {
+    return v, err
+  }
+  // registered classes are resolved once the whole value is read
+  return decoder.resolve(v)
+}
+
+// resolve resolves the registered classes of a value read by readValue,
+// refs between values resolve to the same pointer
+func (decoder *Decoder) resolve(v interface{}) (interface{}, error) {
+  if decoder.resolver == nil {
+    decoder.resolver = newAssigner()
+  }
+  return decoder.resolver.resolve(v)
+}
+
+// resolveValues resolves the values read by readFixedLengthValue
+// or readVariableLengthValue in place
+func (decoder *Decoder) resolveValues(values []interface{}) error {
+  for i, v := range values {
+    var err error
+    if values[i], err = decoder.resolve(v); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// readValue reads the next value without resolving registered classes
+func (decoder *Decoder) readValue() (interface{}, error) {
+  code, err := decoder.peek()
+  if err != nil {
+    return nil, err
+  }
+  codeToType := CODE_TO_TYPE
+  if decoder.v1 {
+    codeToType = CODE_TO_TYPE_V1
+  }
+  typeName, ok := codeToType[code]
+  if !ok {
+    decoder.read()
+    return nil, decoder.syntaxError(decoder.offset - 1, code, "value")
+  }
+  if decoder.depth == 0 {
+    decoder.countTokenValue()
+  }
+  decoder.depth++
+  if err := decoder.checkDepth(decoder.depth + len(decoder.tokens)); err != nil {
+    decoder.depth--
+    return nil, err
+  }
+  v, err := dynamic_call(decoder, typeName)
+  decoder.depth--
+  return v, err
+}
+
 func dynamic_call(decoder *Decoder, typeName string) (interface{}, error) {
   switch typeName {
+  case "null":
+    return decoder.ReadNull()
+  case "bool":
+    return decoder.ReadBoolean()
   case "java.lang.Integer":
     fallthrough
   case "int":
@@ -683,10 +1370,23 @@ func dynamic_call(decoder *Decoder, typeName string) (interface{}, error) {
     fallthrough
   case "java.lang.Long":
     return decoder.ReadLong()
+  case "date":
+    return decoder.ReadDate()
+  case "binary":
+    return decoder.ReadBinary()
+  case "list":
+    return decoder.readListValue()
+  case "map":
+    if decoder.v1 {
+      return decoder.readMapV1()
+    }
+    return decoder.ReadMap()
   case "typedmap":
-    return decoder.ReadTypedMap()
-
+    return decoder.readTypedMap()
+  case "ref":
+    return decoder.ReadRef()
+  case "object":
+    return decoder.readObject()
   }
-  return nil, errors.New("no such method")
+  return nil, fmt.Errorf("hessian: no reader for type %s", typeName)
 }
-
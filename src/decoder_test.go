@@ -1,7 +1,11 @@
 package hessian
 
 import (
+  "bytes"
+  "errors"
 	"fmt"
+  "io"
+  "testing/iotest"
 	"strings"
 	"testing"
   "time"
@@ -261,6 +265,13 @@ func TestReadList(t *testing.T) {
       }
     }
   }
+  // fixed lengths are never negative, -1 does not make a variable-length list
+  for _, code := range [][]byte{{0x58, 0x8f, 0x91, 0x5a}, {0x56, 0x04, 0x5b, 0x69, 0x6e, 0x74, 0x8e, 0x91}} {
+    _, err := NewDecoder(code).ReadValue()
+    if !errors.Is(err, ErrSyntax) {
+      t.Errorf("readList: negative length %x expect syntax error found %v", code, err)
+    }
+  }
 }
 
 func TestReadMap(t *testing.T) {
@@ -316,4 +327,471 @@ func TestReadTypedMap(t *testing.T) {
       t.Errorf("readTypedMap decode error: expect %d found %d", 123, ret.Value["value"])
     }
   }
+  {
+    // java.util.TreeMap<Integer, Object> {1: "a", 2: self}, written with its class name
+    code := []byte{0x4d, 0x11}
+    code = append(code, "java.util.TreeMap"...)
+    code = append(code, 0x91, 0x01, 0x61, 0x92, 0x51, 0x90, 0x5a)
+    v, err := NewDecoder(code).ReadValue()
+    unexpected_error(err, t)
+    m, ok := v.(map[interface{}]interface{})
+    if !ok || m[int32(1)] != "a" || len(m) != 2 {
+      t.Errorf("readTypedMap: int keys expect map found %v", v)
+    } else if self, ok := m[int32(2)].(map[interface{}]interface{}); !ok || len(self) != 2 {
+      t.Errorf("readTypedMap: ref to the map expect the untyped map found %T", m[int32(2)])
+    }
+    if _, err := NewDecoder(code).ReadTypedMap(); err == nil {
+      t.Errorf("readTypedMap: int keys expect error")
+    }
+  }
+  {
+    // the string keys read before the first other key are kept
+    code := []byte{0x4d, 0x11}
+    code = append(code, "java.util.HashMap"...)
+    code = append(code, 0x01, 0x61, 0x91, 0xe2, 0x92, 0x5a)
+    v, err := NewDecoder(code).ReadValue()
+    unexpected_error(err, t)
+    if !reflect.DeepEqual(v, map[interface{}]interface{}{"a": int32(1), int64(2): int32(2)}) {
+      t.Errorf("readTypedMap: mixed keys decode error, found %v", v)
+    }
+  }
+}
+
+func TestReadValue(t *testing.T) {
+  {
+    encoder := NewEncoder()
+    encoder.WriteNull()
+    encoder.WriteBoolean(true)
+    encoder.WriteInt(-1)
+    encoder.WriteLong(1)
+    encoder.WriteDouble(12.25)
+    encoder.WriteString("hello")
+    encoder.WriteBinary([]byte{0x01, 0x02})
+    encoder.WriteDate(time.Unix(11724480 * 60, 0))
+    expected := []interface{}{nil, true, int32(-1), int64(1), 12.25, "hello"}
+    decoder := NewDecoder(encoder.Bytes())
+    for _, e := range expected {
+      v, err := decoder.ReadValue()
+      unexpected_error(err, t)
+      if v != e {
+        t.Errorf("readValue: expect %v found %v", e, v)
+      }
+    }
+    v, err := decoder.ReadValue()
+    unexpected_error(err, t)
+    if b, ok := v.([]byte); !ok || len(b) != 2 {
+      t.Errorf("readValue: binary decode error")
+    }
+    v, err = decoder.ReadValue()
+    unexpected_error(err, t)
+    if d, ok := v.(time.Time); !ok || d.Unix() != 11724480 * 60 {
+      t.Errorf("readValue: date decode error")
+    }
+  }
+  // [1, "a", ["b"]] as variable-length untyped list
+  {
+    code := []byte{0x57, 0x91, 0x01, 0x61, 0x79, 0x01, 0x62, 0x5a}
+    v, err := NewDecoder(code).ReadValue()
+    unexpected_error(err, t)
+    l, ok := v.(*List)
+    if !ok || l.ValueType != UNTYPED || len(l.Value) != 3 {
+      t.Fatalf("readValue: list decode error")
+    }
+    inner, ok := l.Value[2].(*List)
+    if !ok || len(inner.Value) != 1 || inner.Value[0] != "b" {
+      t.Errorf("readValue: nested list decode error")
+    }
+  }
+  // map with a typed map value
+  {
+    encoder := NewEncoder()
+    encoder.WriteMap(map[interface{}]interface{}{
+      "car": TypedMap{"Car", map[string]interface{}{"color": "red"}},
+    })
+    v, err := NewDecoder(encoder.Bytes()).ReadValue()
+    unexpected_error(err, t)
+    m, ok := v.(map[interface{}]interface{})
+    if !ok {
+      t.Fatalf("readValue: map decode error")
+    }
+    car, ok := m["car"].(*TypedMap)
+    if !ok || car.ValueType != "Car" || car.Value["color"] != "red" {
+      t.Errorf("readValue: typed map decode error")
+    }
+  }
+  {
+    _, err := NewDecoder([]byte{0x40}).ReadValue()
+    if err == nil {
+      t.Errorf("readValue should return error")
+    }
+  }
+}
+
+func TestReadObject(t *testing.T) {
+  /**
+   * class Car {
+   *   String color;
+   *   String model;
+   * }
+   * new Car("red", "corvette"), new Car("green", "civic")
+   */
+  code := []byte{0x43, 0x0b, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x43, 0x61, 0x72, 0x92,
+    0x05, 0x63, 0x6f, 0x6c, 0x6f, 0x72, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c,
+    0x60, 0x03, 0x72, 0x65, 0x64, 0x08, 0x63, 0x6f, 0x72, 0x76, 0x65, 0x74, 0x74, 0x65,
+    0x4f, 0x90, 0x05, 0x67, 0x72, 0x65, 0x65, 0x6e, 0x05, 0x63, 0x69, 0x76, 0x69, 0x63}
+  decoder := NewDecoder(code)
+  car, err := decoder.ReadObject()
+  unexpected_error(err, t)
+  if car.ValueType != "example.Car" || len(car.Fields) != 2 || car.Fields[1] != "model" {
+    t.Errorf("readObject: class definition decode error")
+  }
+  if model, ok := car.Get("model"); !ok || model != "corvette" {
+    t.Errorf("readObject: expect %s found %v", "corvette", model)
+  }
+  v, err := decoder.ReadValue()
+  unexpected_error(err, t)
+  other, ok := v.(*Object)
+  if !ok || other.ValueType != "example.Car" {
+    t.Fatalf("readObject: object decode error")
+  }
+  typedMap := other.TypedMap()
+  if typedMap.ValueType != "example.Car" || typedMap.Value["color"] != "green" || typedMap.Value["model"] != "civic" {
+    t.Errorf("readObject: typed map conversion error")
+  }
+  {
+    _, err := NewDecoder([]byte{0x61}).ReadObject()
+    if err == nil {
+      t.Errorf("readObject should return error for unknown class definition")
+    }
+  }
+}
+
+func TestDecoderReader(t *testing.T) {
+  s := strings.Repeat("你", 0x8001)
+  b := bytes.Repeat([]byte{0x01}, 0x10001)
+  encoder := NewEncoder()
+  encoder.WriteString(s)
+  encoder.WriteBinary(b)
+  encoder.WriteInt(65536)
+  decoder := NewDecoderReader(iotest.OneByteReader(bytes.NewReader(encoder.Bytes())))
+  rs, err := decoder.ReadString()
+  unexpected_error(err, t)
+  if rs != s {
+    t.Errorf("readString: chunked string decode error")
+  }
+  rb, err := decoder.ReadBinary()
+  unexpected_error(err, t)
+  if !bytes.Equal(rb, b) {
+    t.Errorf("readBinary: chunked binary decode error")
+  }
+  n, err := decoder.ReadInt()
+  unexpected_error(err, t)
+  if n != 65536 {
+    t.Errorf("readInt: expect 65536 found %d", n)
+  }
+  // java writes the final chunk with the compact code
+  {
+    code := []byte{0x52, 0x00, 0x01, 0xe4, 0xbd, 0xa0, 0x01, 0xe5, 0xa5, 0xbd, 0x53, 0x00, 0x01, 0x61}
+    decoder := NewDecoderReader(bytes.NewReader(code))
+    s, err := decoder.ReadString()
+    unexpected_error(err, t)
+    if s != "你好" {
+      t.Errorf("readString: decoder error")
+    }
+    s, err = decoder.ReadString()
+    unexpected_error(err, t)
+    if s != "a" {
+      t.Errorf("readString: decoder error")
+    }
+  }
+  // truncated data
+  {
+    decoder := NewDecoderReader(bytes.NewReader([]byte{0x53, 0x00, 0x05, 0x61}))
+    _, err := decoder.ReadString()
+    if !errors.Is(err, io.ErrUnexpectedEOF) {
+      t.Errorf("readString: expect %v found %v", io.ErrUnexpectedEOF, err)
+    }
+    decoder = NewDecoderReader(bytes.NewReader([]byte{0x49, 0x00}))
+    _, err = decoder.ReadInt()
+    if err == nil {
+      t.Errorf("readInt should return error")
+    }
+  }
+}
+
+func TestDecoderMark(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteString("你好")
+  encoder.WriteInt(65536)
+  encoder.WriteString(strings.Repeat("好", 100))
+  for _, decoder := range []*Decoder{NewDecoder(encoder.Bytes()), NewDecoderReader(bytes.NewReader(encoder.Bytes()))} {
+    start := decoder.Mark()
+    s, err := decoder.ReadString()
+    unexpected_error(err, t)
+    middle := decoder.Mark()
+    if start != 0 || middle != 7 || decoder.Offset() != 7 {
+      t.Errorf("mark: unexpected offset %d", middle)
+    }
+    _, err = decoder.ReadInt()
+    unexpected_error(err, t)
+    _, err = decoder.ReadString()
+    unexpected_error(err, t)
+    err = decoder.Reset(middle)
+    unexpected_error(err, t)
+    n, err := decoder.ReadInt()
+    unexpected_error(err, t)
+    if n != 65536 {
+      t.Errorf("reset: expect 65536 found %d", n)
+    }
+    err = decoder.Reset(start)
+    unexpected_error(err, t)
+    code, err := decoder.Peek()
+    unexpected_error(err, t)
+    if code != 0x02 || decoder.Offset() != 0 {
+      t.Errorf("reset: unexpected next byte %x", code)
+    }
+    again, err := decoder.ReadString()
+    unexpected_error(err, t)
+    if again != s {
+      t.Errorf("reset: expect %s found %s", s, again)
+    }
+    decoder.Release()
+    if decoder.Reset(start) == nil {
+      t.Errorf("reset should fail after release")
+    }
+    _, err = decoder.ReadInt()
+    unexpected_error(err, t)
+    long, err := decoder.ReadString()
+    unexpected_error(err, t)
+    if long != strings.Repeat("好", 100) || decoder.Offset() != int64(len(encoder.Bytes())) {
+      t.Errorf("reset: decoder error")
+    }
+  }
+}
+
+func TestDecoderMarkTables(t *testing.T) {
+  b := &List{UNTYPED, []interface{}{"b"}}
+  encoder := NewEncoder()
+  encoder.WriteValue(&List{UNTYPED, []interface{}{int32(1)}})
+  encoder.WriteValue(b)
+  encoder.WriteValue(b)
+  encoder.WriteList(List{"[com.acme.A", nil})
+  encoder.WriteList(List{"[com.acme.B", nil})
+  encoder.WriteList(List{"[com.acme.B", nil})
+  decoder := NewDecoder(encoder.Bytes())
+  // a value read speculatively is numbered again when read after Reset
+  mark := decoder.Mark()
+  _, err := decoder.ReadValue()
+  unexpected_error(err, t)
+  unexpected_error(decoder.Reset(mark), t)
+  decoder.Release()
+  var values []interface{}
+  for i := 0; i < 3; i++ {
+    v, err := decoder.ReadValue()
+    unexpected_error(err, t)
+    values = append(values, v)
+  }
+  if values[2] != values[1] {
+    t.Errorf("reset: expect the ref to [b] found %v", values[2])
+  }
+  mark = decoder.Mark()
+  for i := 0; i < 2; i++ {
+    _, err := decoder.ReadValue()
+    unexpected_error(err, t)
+  }
+  unexpected_error(decoder.Reset(mark), t)
+  for i := 0; i < 3; i++ {
+    v, err := decoder.ReadValue()
+    unexpected_error(err, t)
+    values = append(values, v)
+  }
+  if values[5].(*List).ValueType != "[com.acme.B" {
+    t.Errorf("reset: expect the type ref to [com.acme.B found %v", values[5])
+  }
+}
+
+type refNode struct {
+  Name string `hessian:"name"`
+  Next *refNode `hessian:"next"`
+}
+
+func (node *refNode) JavaClassName() string {
+  return "example.Node"
+}
+
+func TestReadRefCycle(t *testing.T) {
+  // a list holding itself and a map: [self, {1: 0x51 1}]
+  code := []byte{0x7a, 0x51, 0x90, 0x48, 0x91, 0x51, 0x91, 0x5a}
+  v, err := NewDecoder(code).ReadValue()
+  unexpected_error(err, t)
+  l, ok := v.(*List)
+  if !ok || len(l.Value) != 2 {
+    t.Fatalf("readRef: list decode error")
+  }
+  if self, ok := l.Value[0].(*List); !ok || self != l {
+    t.Errorf("readRef: list should refer to itself")
+  }
+  m, ok := l.Value[1].(map[interface{}]interface{})
+  if !ok {
+    t.Fatalf("readRef: map decode error")
+  }
+  if inner, ok := m[int32(1)].(map[interface{}]interface{}); !ok || len(inner) != 1 {
+    t.Errorf("readRef: map should refer to itself")
+  }
+}
+
+func TestReadTypeRef(t *testing.T) {
+  // two typed maps sharing the type and a ref to the first one
+  encoder := NewEncoder()
+  car := &TypedMap{"Car", map[string]interface{}{"color": "red"}}
+  encoder.WriteValue([]interface{}{car, TypedMap{"Car", map[string]interface{}{}}, car})
+  code := encoder.Bytes()
+  if code[len(code)-2] != 0x51 || code[len(code)-1] != 0x91 {
+    t.Errorf("writeRef: expect ref to the first typed map, found %x", code)
+  }
+  v, err := NewDecoder(code).ReadValue()
+  unexpected_error(err, t)
+  l := v.(*List)
+  first, _ := l.Value[0].(*TypedMap)
+  second, _ := l.Value[1].(*TypedMap)
+  if first == nil || second == nil || second.ValueType != "Car" || l.Value[2] != first {
+    t.Errorf("readRef: typed map refs decode error")
+  }
+}
+
+func TestMarshalRefCycle(t *testing.T) {
+  a := &refNode{Name: "a"}
+  b := &refNode{Name: "b", Next: a}
+  a.Next = b
+  code, err := Marshal(a)
+  unexpected_error(err, t)
+  v, err := NewDecoder(code).ReadValue()
+  unexpected_error(err, t)
+  object := v.(*Object)
+  next, _ := object.Get("next")
+  back, _ := next.(*Object).Get("next")
+  if back != object {
+    t.Errorf("readRef: object cycle decode error")
+  }
+
+  var decoded refNode
+  err = Unmarshal(code, &decoded)
+  unexpected_error(err, t)
+  if decoded.Name != "a" || decoded.Next.Name != "b" || decoded.Next.Next != &decoded {
+    t.Errorf("unmarshal: cycle should decode to the same pointer")
+  }
+  var list []*refNode
+  err = Unmarshal(mustMarshal(t, []*refNode{a, a}), &list)
+  unexpected_error(err, t)
+  if len(list) != 2 || list[0] != list[1] || list[0].Next.Next != list[0] {
+    t.Errorf("unmarshal: shared node should decode to the same pointer")
+  }
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+  code, err := Marshal(v)
+  unexpected_error(err, t)
+  return code
+}
+
+func TestReadStringUTF16(t *testing.T) {
+  cases := []struct {
+    code []byte
+    expect string
+  }{
+    // cesu-8 as written by java
+    {[]byte{0x04, 0x61, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0x62}, "a\U0001F600b"},
+    // 4-byte utf-8, still two chars long
+    {[]byte{0x04, 0x61, 0xf0, 0x9f, 0x98, 0x80, 0x62}, "a\U0001F600b"},
+    // pair split between chunks
+    {[]byte{0x52, 0x00, 0x01, 0xed, 0xa0, 0xbd, 0x01, 0xed, 0xb8, 0x80}, "\U0001F600"},
+    // java modified utf-8 for U+0000
+    {[]byte{0x01, 0xc0, 0x80}, "\x00"},
+  }
+  for _, c := range cases {
+    // the value after the string must not be shifted
+    decoder := NewDecoder(append(c.code, 0x91))
+    ret, err := decoder.ReadString()
+    unexpected_error(err, t)
+    if ret != c.expect {
+      t.Errorf("readString: %x expect %q found %q", c.code, c.expect, ret)
+    }
+    n, err := decoder.ReadInt()
+    unexpected_error(err, t)
+    if n != 1 {
+      t.Errorf("readString: value after %x decoded as %d", c.code, n)
+    }
+  }
+  invalid := [][]byte{
+    {0x01, 0xff},
+    {0x01, 0xc3, 0x41},
+    {0x01, 0xc1, 0x81},
+    {0x01, 0xed, 0xb8, 0x80},
+    {0x01, 0xed, 0xa0, 0xbd},
+    {0x02, 0xed, 0xa0, 0xbd, 0x61},
+    {0x01, 0xf0, 0x9f, 0x98, 0x80},
+    {0x02, 0xf4, 0x90, 0x80, 0x80},
+  }
+  for _, code := range invalid {
+    _, err := NewDecoder(code).ReadString()
+    var encodingErr *EncodingError
+    if !errors.As(err, &encodingErr) || !errors.Is(err, ErrSyntax) {
+      t.Errorf("readString: %x expect encoding error found %v", code, err)
+    }
+  }
+}
+
+func TestReadPrimitiveList(t *testing.T) {
+  cases := []struct {
+    list List
+    expect interface{}
+  }{
+    {List{"[int", []interface{}{int32(1), int32(-1), int32(65536)}}, []int32{1, -1, 65536}},
+    {List{"[long", []interface{}{int64(1), int64(1) << 40}}, []int64{1, 1 << 40}},
+    {List{"[double", []interface{}{12.25, 0.0}}, []float64{12.25, 0}},
+    {List{"[float", []interface{}{12.25}}, []float32{12.25}},
+    {List{"[short", []interface{}{int32(-300)}}, []int16{-300}},
+    {List{"[byte", []interface{}{int32(-1)}}, []int8{-1}},
+    {List{"[boolean", []interface{}{true, false}}, []bool{true, false}},
+    {List{"[string", []interface{}{"a", nil, "b"}}, []string{"a", "", "b"}},
+    {List{"[int", make([]interface{}, 0)}, []int32{}},
+  }
+  for _, c := range cases {
+    encoder := NewEncoder()
+    encoder.WriteList(c.list)
+    ret, err := NewDecoder(encoder.Bytes()).ReadValue()
+    unexpected_error(err, t)
+    if !reflect.DeepEqual(ret, c.expect) {
+      t.Errorf("readList: %s expect %v found %#v", c.list.ValueType, c.expect, ret)
+    }
+    // ReadList keeps the generic list and the full type
+    l, err := NewDecoder(encoder.Bytes()).ReadList()
+    unexpected_error(err, t)
+    if l.ValueType != c.list.ValueType || len(l.Value) != len(c.list.Value) {
+      t.Errorf("readList: expect %s list found %+v", c.list.ValueType, l)
+    }
+  }
+  {
+    // variable-length list, and a ref to the slice
+    code := []byte{0x7a, 0x55, 0x04, 0x5b, 0x69, 0x6e, 0x74, 0x91, 0x92, 0x5a, 0x51, 0x91}
+    ret, err := NewDecoder(code).ReadValue()
+    unexpected_error(err, t)
+    l, ok := ret.(*List)
+    if !ok || len(l.Value) != 2 || !reflect.DeepEqual(l.Value[0], []int32{1, 2}) || !reflect.DeepEqual(l.Value[1], []int32{1, 2}) {
+      t.Errorf("readList: variable-length int list decode error, found %#v", ret)
+    }
+  }
+  {
+    var dst struct {
+      Ints []int
+      Doubles [2]float32
+    }
+    code, err := Marshal(map[string]interface{}{"Ints": []int32{1, 2}, "Doubles": []float64{0.5, 1}})
+    unexpected_error(err, t)
+    err = Unmarshal(code, &dst)
+    unexpected_error(err, t)
+    if len(dst.Ints) != 2 || dst.Ints[1] != 2 || dst.Doubles[0] != 0.5 {
+      t.Errorf("readList: slice assign error, found %+v", dst)
+    }
+  }
 }
@@ -0,0 +1,318 @@
+package hessian
+
+import (
+  "fmt"
+  "io"
+  "reflect"
+)
+
+// hessian 1.0 tags, the readers are shared with 2.0 and check decoder.v1
+// where the grammars differ
+var CODE_TO_TYPE_V1 = map[byte]string{
+  0x4e: "null",
+  0x54: "bool",
+  0x46: "bool",
+  0x49: "int",
+  0x4c: "long",
+  0x44: "double",
+  0x64: "date",
+  0x53: "string",
+  0x73: "string",
+  0x58: "string", // xml
+  0x78: "string",
+  0x42: "binary",
+  0x62: "binary",
+  0x56: "list",
+  0x4d: "map",
+  0x52: "ref",
+}
+
+// NewDecoderV1 returns a decoder for hessian 1.0 input, values are returned
+// as the same types as hessian 2.0 values
+func NewDecoderV1(b []byte) *Decoder {
+  decoder := NewDecoder(b)
+  decoder.v1 = true
+  return decoder
+}
+
+// NewDecoderV1Reader is like NewDecoderReader for hessian 1.0 input
+func NewDecoderV1Reader(r io.Reader) *Decoder {
+  decoder := NewDecoderReader(r)
+  decoder.v1 = true
+  return decoder
+}
+
+/**
+ * type ::= t b1 b0 type-string
+ * the type is optional, "" is returned without it
+ */
+func (decoder *Decoder) readTypeV1() (string, error) {
+  code, err := decoder.peek()
+  if err != nil || code != 0x74 {
+    return "", err
+  }
+  offset := decoder.offset
+  decoder.read()
+  bits, err := decoder.readn(2)
+  if err != nil {
+    return "", err
+  }
+  s, err := decoder.read_n_char(int(bits[0])<<8 + int(bits[1]))
+  if err != nil {
+    return "", err
+  }
+  return s, decoder.checkClass(offset, s)
+}
+
+/**
+ * list ::= V type? length? value* z
+ * length ::= l b3 b2 b1 b0
+ */
+func (decoder *Decoder) readListV1() (*List, error) {
+  ret, size, err := decoder.readListHeaderV1()
+  if err != nil {
+    return nil, err
+  }
+  return decoder.readListValues(ret, size)
+}
+
+// the length of a 1.0 list is a hint, values always end with 'z'
+func (decoder *Decoder) readListHeaderV1() (*List, int, error) {
+  code, err := decoder.read()
+  if err != nil {
+    return nil, 0, err
+  }
+  if code != 0x56 {
+    return nil, 0, decoder.syntaxError(decoder.offset - 1, code, "list")
+  }
+  typeName, err := decoder.readTypeV1()
+  if err != nil {
+    return nil, 0, decoder.unexpectedEOF(err, "list")
+  }
+  ret := &List{ValueType: UNTYPED}
+  if typeName != "" {
+    ret.ValueType = typeName
+  }
+  code, err = decoder.peek()
+  if err != nil {
+    return nil, 0, decoder.unexpectedEOF(err, "list")
+  }
+  if code == 0x6c {
+    decoder.read()
+    if _, err := decoder.readn(4); err != nil {
+      return nil, 0, err
+    }
+  }
+  return ret, -1, nil
+}
+
+/**
+ * map ::= M type? (value value)* z
+ * typed maps are returned as *TypedMap, untyped ones as map[interface{}]interface{}
+ */
+func (decoder *Decoder) readMapV1() (interface{}, error) {
+  code, err := decoder.read()
+  if err != nil {
+    return nil, err
+  }
+  if code != 0x4d {
+    return nil, decoder.syntaxError(decoder.offset - 1, code, "map")
+  }
+  typeName, err := decoder.readTypeV1()
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "map")
+  }
+  return decoder.readMapEntriesV1(typeName, true)
+}
+
+// reads the entries up to 'z', the map is registered as ref before them
+// unless it is the entries of a fault
+func (decoder *Decoder) readMapEntriesV1(typeName string, ref bool) (interface{}, error) {
+  var typed *typedMapEntries
+  untyped := map[interface{}]interface{}{}
+  var err error
+  if typeName != "" {
+    typed, err = decoder.newTypedMapEntries(typeName, ref)
+  } else if ref {
+    err = decoder.addRef(untyped)
+  }
+  if err != nil {
+    return nil, err
+  }
+  entries := 0
+  for {
+    code, err := decoder.peek()
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "map entry or 'z'")
+    }
+    if code == 0x7a {
+      decoder.read()
+      break
+    }
+    entries++
+    if err := decoder.checkListLen(entries); err != nil {
+      return nil, err
+    }
+    offset := decoder.offset
+    key, err := decoder.ReadValue()
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "map entry or 'z'")
+    }
+    value, err := decoder.ReadValue()
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "map entry or 'z'")
+    }
+    if typed != nil {
+      if err := decoder.putTypedMapEntry(typed, offset, key, value); err != nil {
+        return nil, err
+      }
+      continue
+    }
+    if key != nil && !reflect.TypeOf(key).Comparable() {
+      return nil, fmt.Errorf("hessian: unhashable map key %T at offset %d: %w", key, offset, ErrSyntax)
+    }
+    untyped[key] = value
+  }
+  if typed != nil {
+    return typed.value(), nil
+  }
+  return untyped, nil
+}
+
+/**
+ * ref ::= R b3 b2 b1 b0
+ */
+func (decoder *Decoder) readRefV1() (interface{}, error) {
+  code, err := decoder.read()
+  if err != nil {
+    return nil, err
+  }
+  if code != 0x52 {
+    return nil, decoder.syntaxError(decoder.offset - 1, code, "ref")
+  }
+  offset := decoder.offset
+  bits, err := decoder.readn(4)
+  if err != nil {
+    return nil, err
+  }
+  refId := parseInt32FromBytes(bits)
+  ret, ok := decoder.refMap[refId]
+  if !ok {
+    return nil, &ReferenceError{offset, "ref", refId}
+  }
+  return ret, nil
+}
+
+// header ::= H b1 b0 header-string value
+// headers are skipped
+func (decoder *Decoder) skipHeadersV1() error {
+  for {
+    code, err := decoder.peek()
+    if err != nil {
+      return err
+    }
+    if code != 0x48 {
+      return nil
+    }
+    decoder.read()
+    bits, err := decoder.readn(2)
+    if err != nil {
+      return err
+    }
+    if _, err := decoder.read_n_char(int(bits[0])<<8 + int(bits[1])); err != nil {
+      return err
+    }
+    if _, err := decoder.ReadValue(); err != nil {
+      return decoder.unexpectedEOF(err, "header")
+    }
+  }
+}
+
+// reads the tag and the 1.0 version of a call or reply
+func (decoder *Decoder) readEnvelopeV1(tag byte, expected string) error {
+  code, err := decoder.read()
+  if err != nil {
+    return err
+  }
+  if code != tag {
+    return decoder.syntaxError(decoder.offset - 1, code, expected)
+  }
+  bits, err := decoder.readn(2)
+  if err != nil {
+    return err
+  }
+  if bits[0] != 0x01 || bits[1] != 0x00 {
+    return decoder.syntaxError(decoder.offset - 2, bits[0], "version 1.0")
+  }
+  return decoder.unexpectedEOF(decoder.skipHeadersV1(), expected)
+}
+
+/**
+ * call ::= c x01 x00 header* m b1 b0 method-string value* z
+ */
+func (decoder *Decoder) readCallV1() (string, []interface{}, error) {
+  if err := decoder.readEnvelopeV1(0x63, "call"); err != nil {
+    return "", nil, err
+  }
+  code, err := decoder.read()
+  if err != nil {
+    return "", nil, decoder.unexpectedEOF(err, "method")
+  }
+  if code != 0x6d {
+    return "", nil, decoder.syntaxError(decoder.offset - 1, code, "method")
+  }
+  bits, err := decoder.readn(2)
+  if err != nil {
+    return "", nil, err
+  }
+  method, err := decoder.read_n_char(int(bits[0])<<8 + int(bits[1]))
+  if err != nil {
+    return "", nil, err
+  }
+  args, err := decoder.readVariableLengthValue()
+  if err != nil {
+    return "", nil, decoder.unexpectedEOF(err, "argument")
+  }
+  return method, args, nil
+}
+
+/**
+ * reply ::= r x01 x00 header* value z
+ *       ::= r x01 x00 header* f (value value)* z
+ */
+func (decoder *Decoder) readReplyV1() (interface{}, error) {
+  if err := decoder.readEnvelopeV1(0x72, "reply"); err != nil {
+    return nil, err
+  }
+  code, err := decoder.peek()
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "reply value")
+  }
+  if code == 0x66 {
+    decoder.read()
+    fields, err := decoder.readMapEntriesV1("", false)
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "fault")
+    }
+    return nil, newFault(mapEntries(fields))
+  }
+  ret, err := decoder.readValue()
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "reply value")
+  }
+  if err := decoder.readEndV1("reply"); err != nil {
+    return nil, err
+  }
+  return ret, nil
+}
+
+func (decoder *Decoder) readEndV1(expected string) error {
+  code, err := decoder.read()
+  if err != nil {
+    return decoder.unexpectedEOF(err, "'z'")
+  }
+  if code != 0x7a {
+    return decoder.syntaxError(decoder.offset - 1, code, "end of " + expected)
+  }
+  return nil
+}
@@ -0,0 +1,146 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "reflect"
+  "testing"
+  "time"
+)
+
+// hessian 1.0 string, xml and type payloads: tag b1 b0 data
+func v1Chunk(tag byte, s string) []byte {
+  return append([]byte{tag, byte(len(s) >> 8), byte(len(s))}, s...)
+}
+
+func TestDecoderV1Primitives(t *testing.T) {
+  tests := []struct {
+    code []byte
+    expect interface{}
+  }{
+    {[]byte{0x4e}, nil},
+    {[]byte{0x54}, true},
+    {[]byte{0x49, 0x00, 0x00, 0x01, 0x2c}, int32(300)},
+    {[]byte{0x4c, 0, 0, 0, 0, 0, 0, 0x01, 0x2c}, int64(300)},
+    {[]byte{0x44, 0x40, 0x28, 0x80, 0, 0, 0, 0, 0}, 12.25},
+    {v1Chunk(0x53, "hello"), "hello"},
+    {append(v1Chunk(0x73, "hel"), v1Chunk(0x53, "lo")...), "hello"},
+    {append(v1Chunk(0x78, "<a>"), v1Chunk(0x58, "</a>")...), "<a></a>"},
+    {[]byte{0x62, 0x00, 0x02, 0x01, 0x02, 0x42, 0x00, 0x01, 0x03}, []byte{1, 2, 3}},
+  }
+  for _, test := range tests {
+    v, err := NewDecoderV1(test.code).ReadValue()
+    unexpected_error(err, t)
+    if !reflect.DeepEqual(v, test.expect) {
+      t.Errorf("readValueV1: %x expect %v found %v", test.code, test.expect, v)
+    }
+  }
+  date, err := NewDecoderV1([]byte{0x64, 0x00, 0x00, 0x01, 0x5e, 0x31, 0x6b, 0xe5, 0xce}).ReadDate()
+  unexpected_error(err, t)
+  if !date.Equal(time.Unix(1504067708, 366e6)) {
+    t.Errorf("readDateV1: decode error, found %v", date)
+  }
+  // 2.0 compact forms are not 1.0 values
+  if _, err := NewDecoderV1([]byte{0x91}).ReadValue(); !errors.Is(err, ErrSyntax) {
+    t.Errorf("readValueV1: expect syntax error found %v", err)
+  }
+  if _, err := NewDecoderV1([]byte{0x05, 0x68}).ReadString(); !errors.Is(err, ErrSyntax) {
+    t.Errorf("readStringV1: expect syntax error found %v", err)
+  }
+}
+
+func TestDecoderV1Containers(t *testing.T) {
+  // V t "[int" l 2 I 1 I 2 z
+  code := append([]byte{0x56}, v1Chunk(0x74, "[int")...)
+  code = append(code, 0x6c, 0, 0, 0, 2, 0x49, 0, 0, 0, 1, 0x49, 0, 0, 0, 2, 0x7a)
+  list, err := NewDecoderV1(code).ReadList()
+  unexpected_error(err, t)
+  if list.ValueType != "[int" || !reflect.DeepEqual(list.Value, []interface{}{int32(1), int32(2)}) {
+    t.Errorf("readListV1: decode error, found %v", list)
+  }
+  ints, err := NewDecoderV1(code).ReadValue()
+  unexpected_error(err, t)
+  if !reflect.DeepEqual(ints, []int32{1, 2}) {
+    t.Errorf("readListV1: expect []int32 found %#v", ints)
+  }
+  list, err = NewDecoderV1([]byte{0x56, 0x4e, 0x7a}).ReadList()
+  unexpected_error(err, t)
+  if list.ValueType != UNTYPED || len(list.Value) != 1 {
+    t.Errorf("readListV1: decode error, found %v", list)
+  }
+
+  // M t "" S "a" I 1 z, java HashMap is written with an empty type
+  code = append([]byte{0x4d}, v1Chunk(0x74, "")...)
+  code = append(code, v1Chunk(0x53, "a")...)
+  code = append(code, 0x49, 0, 0, 0, 1, 0x7a)
+  v, err := NewDecoderV1(code).ReadValue()
+  unexpected_error(err, t)
+  if !reflect.DeepEqual(v, map[interface{}]interface{}{"a": int32(1)}) {
+    t.Errorf("readMapV1: decode error, found %v", v)
+  }
+
+  // M t "com.acme.Car" color "red" self R 0 z
+  code = append([]byte{0x4d}, v1Chunk(0x74, "com.acme.Car")...)
+  code = append(code, v1Chunk(0x53, "color")...)
+  code = append(code, v1Chunk(0x53, "red")...)
+  code = append(code, v1Chunk(0x53, "self")...)
+  code = append(code, 0x52, 0, 0, 0, 0, 0x7a)
+  v, err = NewDecoderV1(code).ReadValue()
+  unexpected_error(err, t)
+  car, ok := v.(*TypedMap)
+  if !ok || car.ValueType != "com.acme.Car" || car.Value["color"] != "red" || car.Value["self"] != car {
+    t.Errorf("readMapV1: decode error, found %v", v)
+  }
+  // M t "java.util.TreeMap" I 1 S "a" z
+  intKeys := append([]byte{0x4d}, v1Chunk(0x74, "java.util.TreeMap")...)
+  intKeys = append(intKeys, 0x49, 0, 0, 0, 1)
+  intKeys = append(intKeys, v1Chunk(0x53, "a")...)
+  intKeys = append(intKeys, 0x7a)
+  v, err = NewDecoderV1(intKeys).ReadValue()
+  unexpected_error(err, t)
+  if !reflect.DeepEqual(v, map[interface{}]interface{}{int32(1): "a"}) {
+    t.Errorf("readMapV1: int keys decode error, found %v", v)
+  }
+  var decoded unmarshalCar
+  unexpected_error(NewDecoderV1(code).Decode(&decoded), t)
+  if decoded.Color != "red" {
+    t.Errorf("decodeV1: decode error, found %+v", decoded)
+  }
+  if _, err := NewDecoderV1([]byte{0x52, 0, 0, 0, 1}).ReadValue(); !errors.Is(err, ErrSyntax) {
+    t.Errorf("readRefV1: expect reference error found %v", err)
+  }
+}
+
+func TestDecoderV1Call(t *testing.T) {
+  // c 1 0 H "trace" S "t1" m "add2" I 2 I 3 z
+  code := append([]byte{0x63, 0x01, 0x00}, v1Chunk(0x48, "trace")...)
+  code = append(code, v1Chunk(0x53, "t1")...)
+  code = append(code, v1Chunk(0x6d, "add2")...)
+  code = append(code, 0x49, 0, 0, 0, 2, 0x49, 0, 0, 0, 3, 0x7a)
+  method, args, err := NewDecoderV1Reader(bytes.NewReader(code)).ReadCall()
+  unexpected_error(err, t)
+  if method != "add2" || !reflect.DeepEqual(args, []interface{}{int32(2), int32(3)}) {
+    t.Errorf("readCallV1: decode error, found %s %v", method, args)
+  }
+
+  v, err := NewDecoderV1([]byte{0x72, 0x01, 0x00, 0x49, 0, 0, 0, 5, 0x7a}).ReadReply()
+  unexpected_error(err, t)
+  if v != int32(5) {
+    t.Errorf("readReplyV1: expect 5 found %v", v)
+  }
+
+  code = []byte{0x72, 0x01, 0x00, 0x66}
+  code = append(code, v1Chunk(0x53, "code")...)
+  code = append(code, v1Chunk(0x53, "ServiceException")...)
+  code = append(code, v1Chunk(0x53, "message")...)
+  code = append(code, v1Chunk(0x53, "failed")...)
+  code = append(code, 0x7a)
+  _, err = NewDecoderV1(code).ReadReply()
+  var fault *Fault
+  if !errors.As(err, &fault) || fault.Code != "ServiceException" || fault.Message != "failed" {
+    t.Errorf("readReplyV1: expect fault found %v", err)
+  }
+  if _, err := NewDecoderV1([]byte{0x72, 0x02, 0x00}).ReadReply(); !errors.Is(err, ErrSyntax) {
+    t.Errorf("readReplyV1: expect syntax error found %v", err)
+  }
+}
@@ -0,0 +1,480 @@
+package hessian
+
+import (
+  "fmt"
+  "io"
+  "reflect"
+  "strings"
+)
+
+/**
+ * dubbo ::= header body
+ * header ::= xda xbb flag status b7 b6 b5 b4 b3 b2 b1 b0 b3 b2 b1 b0
+ *        # magic, flag, status, request id and body length
+ * request body ::= string string string string string value* map
+ *        # dubbo version, path, version, method, parameter types, args, attachments
+ * response body ::= int value? map?   # OK status
+ *               ::= string            # error message of other status
+ * the body of heartbeat events is null
+ */
+
+const (
+  DubboMagic = 0xdabb
+  DubboVersion = "2.0.2"
+  DubboHeaderLength = 16
+  // largest body read, the dubbo default payload
+  DubboMaxBodyLength = 8 << 20
+)
+
+const (
+  dubboFlagRequest = 0x80
+  dubboFlagTwoWay = 0x40
+  dubboFlagEvent = 0x20
+  dubboSerializationMask = 0x1f
+  dubboHessian2 = 0x02
+)
+
+// response status
+const (
+  DubboOK byte = 20
+  DubboClientTimeout byte = 30
+  DubboServerTimeout byte = 31
+  DubboBadRequest byte = 40
+  DubboBadResponse byte = 50
+  DubboServiceNotFound byte = 60
+  DubboServiceError byte = 70
+  DubboServerError byte = 80
+  DubboClientError byte = 90
+  DubboThreadPoolExhausted byte = 100
+)
+
+// first value of an OK response body
+const (
+  dubboResponseException = 0
+  dubboResponseValue = 1
+  dubboResponseNull = 2
+  dubboResponseExceptionWithAttachments = 3
+  dubboResponseValueWithAttachments = 4
+  dubboResponseNullWithAttachments = 5
+)
+
+type DubboRequest struct {
+  ID int64
+  TwoWay bool
+  Event bool // heartbeat, the other fields are not sent
+  DubboVersion string // DubboVersion when empty
+  Path string // service interface, like "com.acme.UserService"
+  Version string
+  Method string
+  ParameterTypes string // jvm descriptors like "Ljava/lang/String;I", taken from Args when empty
+  Args []interface{}
+  Attachments map[string]interface{}
+}
+
+type DubboResponse struct {
+  ID int64
+  Status byte
+  Event bool // heartbeat
+  Value interface{}
+  Exception interface{} // throwable of the provider, usually an *Object
+  ErrorMessage string // message of a status other than DubboOK
+  Attachments map[string]interface{}
+}
+
+// Err returns the exception or the error status of the response as *Fault,
+// nil for a value
+func (resp *DubboResponse) Err() error {
+  if resp.Status != DubboOK {
+    return &Fault{Code: fmt.Sprintf("status %d", resp.Status), Message: resp.ErrorMessage}
+  }
+  if resp.Exception == nil {
+    return nil
+  }
+  fault := &Fault{Code: "Exception", Detail: resp.Exception}
+  if object, ok := resp.Exception.(*Object); ok {
+    fault.Code = object.ValueType
+    if message, ok := object.Get("detailMessage"); ok {
+      fault.Message, _ = message.(string)
+    }
+  }
+  return fault
+}
+
+func writeDubbo(w io.Writer, flag, status byte, id int64, body []byte) error {
+  if len(body) > DubboMaxBodyLength {
+    return fmt.Errorf("hessian: dubbo body of %d bytes exceeds %d", len(body), DubboMaxBodyLength)
+  }
+  bits := make([]byte, 0, DubboHeaderLength + len(body))
+  bits = append(bits, DubboMagic >> 8, DubboMagic & 0xff, flag, status)
+  bits = append(bits, int64ToBytes(id)...)
+  bits = append(bits, int32ToBytes(int32(len(body)))...)
+  bits = append(bits, body...)
+  _, err := w.Write(bits)
+  return err
+}
+
+// WriteDubboRequest writes req with a hessian2 body
+func WriteDubboRequest(w io.Writer, req *DubboRequest) error {
+  flag := byte(dubboFlagRequest | dubboHessian2)
+  if req.TwoWay {
+    flag |= dubboFlagTwoWay
+  }
+  encoder := NewEncoder()
+  if req.Event {
+    flag |= dubboFlagEvent
+    encoder.WriteNull()
+    return writeDubbo(w, flag, 0, req.ID, encoder.Bytes())
+  }
+  version := req.DubboVersion
+  if version == "" {
+    version = DubboVersion
+  }
+  types := req.ParameterTypes
+  if types == "" {
+    for _, arg := range req.Args {
+      types += dubboDescriptor(reflect.ValueOf(arg))
+    }
+  }
+  for _, s := range []string{version, req.Path, req.Version, req.Method, types} {
+    encoder.WriteString(s)
+  }
+  for _, arg := range req.Args {
+    if err := encoder.Encode(arg); err != nil {
+      return err
+    }
+  }
+  attachments := req.Attachments
+  if attachments == nil {
+    attachments = map[string]interface{}{}
+  }
+  if err := encoder.Encode(attachments); err != nil {
+    return err
+  }
+  return writeDubbo(w, flag, 0, req.ID, encoder.Bytes())
+}
+
+// WriteDubboResponse writes resp with a hessian2 body
+func WriteDubboResponse(w io.Writer, resp *DubboResponse) error {
+  flag := byte(dubboHessian2)
+  encoder := NewEncoder()
+  if resp.Event {
+    flag |= dubboFlagEvent
+    encoder.WriteNull()
+    return writeDubbo(w, flag, resp.Status, resp.ID, encoder.Bytes())
+  }
+  if resp.Status != DubboOK {
+    encoder.WriteString(resp.ErrorMessage)
+    return writeDubbo(w, flag, resp.Status, resp.ID, encoder.Bytes())
+  }
+  var kind int32
+  var value interface{}
+  switch {
+  case resp.Exception != nil:
+    kind, value = dubboResponseException, resp.Exception
+  case resp.Value != nil:
+    kind, value = dubboResponseValue, resp.Value
+  default:
+    kind = dubboResponseNull
+  }
+  if resp.Attachments != nil {
+    kind += dubboResponseExceptionWithAttachments
+  }
+  encoder.WriteInt(kind)
+  if kind != dubboResponseNull && kind != dubboResponseNullWithAttachments {
+    if err := encoder.Encode(value); err != nil {
+      return err
+    }
+  }
+  if resp.Attachments != nil {
+    if err := encoder.Encode(resp.Attachments); err != nil {
+      return err
+    }
+  }
+  return writeDubbo(w, flag, resp.Status, resp.ID, encoder.Bytes())
+}
+
+// ReadDubboMessage reads a request or a response, returned as *DubboRequest
+// or *DubboResponse. io.EOF is returned when r ends before a message
+func ReadDubboMessage(r io.Reader) (interface{}, error) {
+  return ReadDubboMessageOptions(r, DecoderOptions{})
+}
+
+// ReadDubboMessageOptions is like ReadDubboMessage, the body is read with options
+func ReadDubboMessageOptions(r io.Reader, options DecoderOptions) (interface{}, error) {
+  header := make([]byte, DubboHeaderLength)
+  if n, err := io.ReadFull(r, header); err != nil {
+    if err == io.EOF {
+      return nil, err
+    }
+    if err == io.ErrUnexpectedEOF {
+      return nil, &UnexpectedEOFError{int64(n), "dubbo header"}
+    }
+    return nil, err
+  }
+  if header[0] != DubboMagic >> 8 {
+    return nil, &SyntaxError{0, header[0], "dubbo magic"}
+  }
+  if header[1] != DubboMagic & 0xff {
+    return nil, &SyntaxError{1, header[1], "dubbo magic"}
+  }
+  flag, status := header[2], header[3]
+  if flag & dubboSerializationMask != dubboHessian2 {
+    return nil, fmt.Errorf("hessian: dubbo serialization %d is not hessian2", flag & dubboSerializationMask)
+  }
+  id := parseInt64FromBytes(header[4:12])
+  length := parseInt32FromBytes(header[12:16])
+  if length < 0 || length > DubboMaxBodyLength {
+    return nil, fmt.Errorf("hessian: dubbo body length %d out of range: %w", length, ErrSyntax)
+  }
+  body := make([]byte, length)
+  if n, err := io.ReadFull(r, body); err != nil {
+    if err == io.EOF || err == io.ErrUnexpectedEOF {
+      return nil, &UnexpectedEOFError{int64(DubboHeaderLength + n), "dubbo body"}
+    }
+    return nil, err
+  }
+  decoder := NewDecoder(body)
+  decoder.SetOptions(options)
+  if flag & dubboFlagRequest != 0 {
+    req := &DubboRequest{
+      ID: id,
+      TwoWay: flag & dubboFlagTwoWay != 0,
+      Event: flag & dubboFlagEvent != 0,
+    }
+    if req.Event {
+      return req, nil
+    }
+    return req, decoder.readDubboRequest(req)
+  }
+  resp := &DubboResponse{
+    ID: id,
+    Status: status,
+    Event: flag & dubboFlagEvent != 0,
+  }
+  if resp.Event {
+    return resp, nil
+  }
+  return resp, decoder.readDubboResponse(resp)
+}
+
+// ReadDubboRequest is like ReadDubboMessage but fails on responses
+func ReadDubboRequest(r io.Reader) (*DubboRequest, error) {
+  msg, err := ReadDubboMessage(r)
+  if err != nil {
+    return nil, err
+  }
+  req, ok := msg.(*DubboRequest)
+  if !ok {
+    return nil, fmt.Errorf("hessian: dubbo response read, request expected")
+  }
+  return req, nil
+}
+
+// ReadDubboResponse is like ReadDubboMessage but fails on requests
+func ReadDubboResponse(r io.Reader) (*DubboResponse, error) {
+  msg, err := ReadDubboMessage(r)
+  if err != nil {
+    return nil, err
+  }
+  resp, ok := msg.(*DubboResponse)
+  if !ok {
+    return nil, fmt.Errorf("hessian: dubbo request read, response expected")
+  }
+  return resp, nil
+}
+
+// reads a string that may be null
+func (decoder *Decoder) readDubboString(expected string) (string, error) {
+  offset := decoder.offset
+  v, err := decoder.ReadValue()
+  if err != nil {
+    return "", decoder.unexpectedEOF(err, expected)
+  }
+  if v == nil {
+    return "", nil
+  }
+  s, ok := v.(string)
+  if !ok {
+    return "", fmt.Errorf("hessian: dubbo %s is %T at offset %d: %w", expected, v, offset, ErrSyntax)
+  }
+  return s, nil
+}
+
+func (decoder *Decoder) readDubboAttachments() (map[string]interface{}, error) {
+  v, err := decoder.ReadValue()
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "attachments")
+  }
+  if v == nil {
+    return nil, nil
+  }
+  entries := mapEntries(v)
+  if entries == nil {
+    return nil, fmt.Errorf("hessian: dubbo attachments are %T, map expected: %w", v, ErrSyntax)
+  }
+  ret := make(map[string]interface{}, len(entries))
+  for k, item := range entries {
+    ret[fmt.Sprint(k)] = item
+  }
+  return ret, nil
+}
+
+func (decoder *Decoder) readDubboRequest(req *DubboRequest) (err error) {
+  fields := []*string{&req.DubboVersion, &req.Path, &req.Version, &req.Method, &req.ParameterTypes}
+  names := []string{"dubbo version", "path", "version", "method", "parameter types"}
+  for i, field := range fields {
+    if *field, err = decoder.readDubboString(names[i]); err != nil {
+      return err
+    }
+  }
+  types, err := splitDescriptors(req.ParameterTypes)
+  if err != nil {
+    return err
+  }
+  if req.Args, err = decoder.readFixedLengthValue(len(types)); err != nil {
+    return decoder.unexpectedEOF(err, "argument")
+  }
+  if err := decoder.resolveValues(req.Args); err != nil {
+    return err
+  }
+  // old versions may leave out the attachments
+  if _, err := decoder.peek(); err == io.EOF {
+    return nil
+  }
+  req.Attachments, err = decoder.readDubboAttachments()
+  return err
+}
+
+func (decoder *Decoder) readDubboResponse(resp *DubboResponse) error {
+  if resp.Status != DubboOK {
+    message, err := decoder.readDubboString("error message")
+    resp.ErrorMessage = message
+    return err
+  }
+  kind, err := decoder.ReadInt()
+  if err != nil {
+    return decoder.unexpectedEOF(err, "response type")
+  }
+  switch kind {
+  case dubboResponseException, dubboResponseExceptionWithAttachments:
+    resp.Exception, err = decoder.ReadValue()
+  case dubboResponseValue, dubboResponseValueWithAttachments:
+    resp.Value, err = decoder.ReadValue()
+  case dubboResponseNull, dubboResponseNullWithAttachments:
+  default:
+    return fmt.Errorf("hessian: unknown dubbo response type %d: %w", kind, ErrSyntax)
+  }
+  if err != nil {
+    return decoder.unexpectedEOF(err, "response value")
+  }
+  if kind >= dubboResponseExceptionWithAttachments {
+    resp.Attachments, err = decoder.readDubboAttachments()
+  }
+  return err
+}
+
+/**
+ * descriptor ::= [ZBCDFIJSV]
+ *            ::= L class-name ;
+ *            ::= [ descriptor
+ */
+func splitDescriptors(desc string) ([]string, error) {
+  ret := []string{}
+  for i := 0; i < len(desc); {
+    start := i
+    for i < len(desc) && desc[i] == '[' {
+      i++
+    }
+    if i == len(desc) {
+      return nil, fmt.Errorf("hessian: bad dubbo parameter types %q: %w", desc, ErrSyntax)
+    }
+    switch desc[i] {
+    case 'Z', 'B', 'C', 'D', 'F', 'I', 'J', 'S', 'V':
+      i++
+    case 'L':
+      end := strings.IndexByte(desc[i:], ';')
+      if end < 0 {
+        return nil, fmt.Errorf("hessian: bad dubbo parameter types %q: %w", desc, ErrSyntax)
+      }
+      i += end + 1
+    default:
+      return nil, fmt.Errorf("hessian: bad dubbo parameter types %q: %w", desc, ErrSyntax)
+    }
+    ret = append(ret, desc[start:i])
+  }
+  return ret, nil
+}
+
+// dubboDescriptor returns the jvm descriptor of the parameter v is written for
+func dubboDescriptor(v reflect.Value) string {
+  if !v.IsValid() {
+    return "Ljava/lang/Object;"
+  }
+  switch value := v.Interface().(type) {
+  case TypedMap:
+    return classDescriptor(value.ValueType)
+  case *TypedMap:
+    return classDescriptor(value.ValueType)
+  case Object:
+    return classDescriptor(value.ValueType)
+  case *Object:
+    return classDescriptor(value.ValueType)
+  }
+  if v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+    if v.IsNil() {
+      return "Ljava/lang/Object;"
+    }
+    return dubboDescriptor(v.Elem())
+  }
+  return typeDescriptor(v.Type())
+}
+
+func classDescriptor(className string) string {
+  if className == "" {
+    return "Ljava/util/Map;"
+  }
+  return "L" + strings.Replace(className, ".", "/", -1) + ";"
+}
+
+func typeDescriptor(t reflect.Type) string {
+  switch t {
+  case timeType:
+    return "Ljava/util/Date;"
+  case reflect.TypeOf(List{}):
+    return "Ljava/util/List;"
+  }
+  switch t.Kind() {
+  case reflect.Ptr:
+    return typeDescriptor(t.Elem())
+  case reflect.Bool:
+    return "Z"
+  case reflect.Int8:
+    return "B"
+  case reflect.Int16:
+    return "S"
+  case reflect.Int32, reflect.Uint8, reflect.Uint16:
+    return "I"
+  case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+    return "J"
+  case reflect.Float32:
+    return "F"
+  case reflect.Float64:
+    return "D"
+  case reflect.String:
+    return "Ljava/lang/String;"
+  case reflect.Slice, reflect.Array:
+    if t.Elem().Kind() == reflect.Uint8 {
+      return "[B"
+    }
+    // typed lists are read as java arrays
+    if listTypeName(t.Elem()) != "" {
+      return "[" + typeDescriptor(t.Elem())
+    }
+    return "Ljava/util/List;"
+  case reflect.Map:
+    return "Ljava/util/Map;"
+  case reflect.Struct:
+    return classDescriptor(javaClassName(reflect.New(t).Elem()))
+  }
+  return "Ljava/lang/Object;"
+}
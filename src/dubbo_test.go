@@ -0,0 +1,158 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "net"
+  "reflect"
+  "testing"
+)
+
+func TestDubboHeader(t *testing.T) {
+  var buf bytes.Buffer
+  unexpected_error(WriteDubboRequest(&buf, &DubboRequest{ID: 258, TwoWay: true, Event: true}), t)
+  expect := []byte{0xda, 0xbb, 0xe2, 0x00, 0, 0, 0, 0, 0, 0, 0x01, 0x02, 0, 0, 0, 0x01, 0x4e}
+  if !bytes.Equal(buf.Bytes(), expect) {
+    t.Errorf("dubbo: expect %x found %x", expect, buf.Bytes())
+  }
+  req, err := ReadDubboRequest(&buf)
+  unexpected_error(err, t)
+  if req.ID != 258 || !req.TwoWay || !req.Event {
+    t.Errorf("dubbo: decode heartbeat error, found %+v", req)
+  }
+  {
+    _, err := ReadDubboMessage(bytes.NewReader([]byte{0xca, 0xfe}))
+    if !errors.Is(err, ErrUnexpectedEOF) {
+      t.Errorf("dubbo: expect unexpected EOF found %v", err)
+    }
+    _, err = ReadDubboMessage(bytes.NewReader(append([]byte{0xca, 0xfe}, expect[2:]...)))
+    if !errors.Is(err, ErrSyntax) {
+      t.Errorf("dubbo: expect syntax error found %v", err)
+    }
+    _, err = ReadDubboMessage(bytes.NewReader(expect[:16]))
+    if !errors.Is(err, ErrUnexpectedEOF) {
+      t.Errorf("dubbo: expect unexpected EOF found %v", err)
+    }
+  }
+}
+
+func TestDubboDescriptor(t *testing.T) {
+  tests := []struct {
+    v interface{}
+    expect string
+  }{
+    {int32(1), "I"},
+    {int64(1), "J"},
+    {true, "Z"},
+    {1.5, "D"},
+    {"s", "Ljava/lang/String;"},
+    {[]byte{1}, "[B"},
+    {[]int32{1}, "[I"},
+    {[]string{"s"}, "[Ljava/lang/String;"},
+    {[]interface{}{1}, "Ljava/util/List;"},
+    {map[string]int{}, "Ljava/util/Map;"},
+    {&marshalUser{}, "Lcom/acme/User;"},
+    {[]*marshalUser{}, "[Lcom/acme/User;"},
+    {nil, "Ljava/lang/Object;"},
+  }
+  for _, test := range tests {
+    if desc := dubboDescriptor(reflect.ValueOf(test.v)); desc != test.expect {
+      t.Errorf("dubbo: descriptor of %T expect %s found %s", test.v, test.expect, desc)
+    }
+    types, err := splitDescriptors(test.expect)
+    unexpected_error(err, t)
+    if len(types) != 1 {
+      t.Errorf("dubbo: split %s found %v", test.expect, types)
+    }
+  }
+  types, err := splitDescriptors("Ljava/lang/String;I[[JLcom/acme/User;")
+  unexpected_error(err, t)
+  if !reflect.DeepEqual(types, []string{"Ljava/lang/String;", "I", "[[J", "Lcom/acme/User;"}) {
+    t.Errorf("dubbo: split error, found %v", types)
+  }
+  for _, desc := range []string{"Ljava/lang/String", "[", "X"} {
+    if _, err := splitDescriptors(desc); !errors.Is(err, ErrSyntax) {
+      t.Errorf("dubbo: split %s expect syntax error found %v", desc, err)
+    }
+  }
+}
+
+func TestDubboLoopback(t *testing.T) {
+  ln, err := net.Listen("tcp", "127.0.0.1:0")
+  unexpected_error(err, t)
+  defer ln.Close()
+  // a provider replying to sayHello and failing other methods
+  go func() {
+    conn, err := ln.Accept()
+    if err != nil {
+      return
+    }
+    defer conn.Close()
+    for {
+      req, err := ReadDubboRequest(conn)
+      if err != nil {
+        return
+      }
+      resp := &DubboResponse{ID: req.ID, Status: DubboOK, Event: req.Event}
+      switch {
+      case req.Event:
+      case req.Method == "sayHello" && req.ParameterTypes == "Ljava/lang/String;I":
+        resp.Value = req.Args[0].(string) + " " + req.Attachments["group"].(string)
+        resp.Attachments = map[string]interface{}{"traceId": "t1"}
+      case req.Method == "throw":
+        resp.Exception = Object{
+          ValueType: "java.lang.IllegalStateException",
+          Fields: []string{"detailMessage"},
+          Value: []interface{}{"bad state"},
+        }
+      default:
+        resp.Status = DubboServiceNotFound
+        resp.ErrorMessage = "no method " + req.Method
+      }
+      if err := WriteDubboResponse(conn, resp); err != nil {
+        return
+      }
+    }
+  }()
+  conn, err := net.Dial("tcp", ln.Addr().String())
+  unexpected_error(err, t)
+  defer conn.Close()
+
+  unexpected_error(WriteDubboRequest(conn, &DubboRequest{
+    ID: 1,
+    TwoWay: true,
+    Path: "com.acme.Greeter",
+    Version: "1.0.0",
+    Method: "sayHello",
+    Args: []interface{}{"hello", int32(1)},
+    Attachments: map[string]interface{}{"group": "g1"},
+  }), t)
+  resp, err := ReadDubboResponse(conn)
+  unexpected_error(err, t)
+  unexpected_error(resp.Err(), t)
+  if resp.ID != 1 || resp.Value != "hello g1" || resp.Attachments["traceId"] != "t1" {
+    t.Errorf("dubbo: decode response error, found %+v", resp)
+  }
+
+  unexpected_error(WriteDubboRequest(conn, &DubboRequest{ID: 2, TwoWay: true, Path: "com.acme.Greeter", Method: "throw"}), t)
+  resp, err = ReadDubboResponse(conn)
+  unexpected_error(err, t)
+  var fault *Fault
+  if err := resp.Err(); !errors.As(err, &fault) || fault.Code != "java.lang.IllegalStateException" || fault.Message != "bad state" {
+    t.Errorf("dubbo: expect exception found %v", err)
+  }
+
+  unexpected_error(WriteDubboRequest(conn, &DubboRequest{ID: 3, TwoWay: true, Method: "missing"}), t)
+  resp, err = ReadDubboResponse(conn)
+  unexpected_error(err, t)
+  if resp.Status != DubboServiceNotFound || resp.ErrorMessage != "no method missing" || resp.Err() == nil {
+    t.Errorf("dubbo: expect service not found found %+v", resp)
+  }
+
+  unexpected_error(WriteDubboRequest(conn, &DubboRequest{ID: 4, TwoWay: true, Event: true}), t)
+  resp, err = ReadDubboResponse(conn)
+  unexpected_error(err, t)
+  if resp.ID != 4 || !resp.Event {
+    t.Errorf("dubbo: expect heartbeat found %+v", resp)
+  }
+}
@@ -0,0 +1,309 @@
+package hessian
+
+import (
+  "encoding/hex"
+  "fmt"
+  "io"
+  "strings"
+  "time"
+)
+
+// DumpOptions controls how Dump prints a payload
+type DumpOptions struct {
+  // Hex prints every byte of the payload next to the value it belongs to,
+  // instead of the leading byte only
+  Hex bool
+  // V1 reads the payload as hessian 1.0
+  V1 bool
+  // Decoder bounds the payload read
+  Decoder DecoderOptions
+}
+
+// Dump writes the hessian payload b to w as an indented tree, one line per
+// value with its offset, its leading byte and its decoded type. containers
+// are followed by their values, map keys by their value, and a call or reply
+// envelope is printed as well. the lines read before a malformed value are
+// written before its error is returned
+func Dump(w io.Writer, b []byte, options DumpOptions) error {
+  d := &dumper{w: w, b: b, hex: options.Hex, decoder: NewDecoder(b)}
+  if options.V1 {
+    d.decoder = NewDecoderV1(b)
+  }
+  d.decoder.SetOptions(options.Decoder)
+  if err := d.envelope(); err != nil {
+    return err
+  }
+  for d.decoder.offset < int64(len(b)) {
+    if err := d.value(0, ""); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+type dumper struct {
+  w io.Writer
+  b []byte
+  hex bool
+  decoder *Decoder
+}
+
+const dumpHexWidth = 16
+
+// line prints the bytes from start to the decoder offset as one line of the tree
+func (d *dumper) line(start int64, depth int, format string, args ...interface{}) error {
+  b := d.b[start:d.decoder.offset]
+  text := strings.Repeat("  ", depth) + fmt.Sprintf(format, args...)
+  if !d.hex {
+    _, err := fmt.Fprintf(d.w, "%06x  %02x  %s\n", start, b[0], text)
+    return err
+  }
+  // long values continue on the following lines without text
+  for i := 0; i == 0 || i < len(b); i += dumpHexWidth {
+    chunk := b[i:]
+    if len(chunk) > dumpHexWidth {
+      chunk = chunk[:dumpHexWidth]
+    }
+    line := fmt.Sprintf("%06x  %-*s  %s", start + int64(i), dumpHexWidth * 3 - 1, hexBytes(chunk), text)
+    if _, err := fmt.Fprintln(d.w, strings.TrimRight(line, " ")); err != nil {
+      return err
+    }
+    text = ""
+  }
+  return nil
+}
+
+func hexBytes(b []byte) string {
+  s := make([]string, len(b))
+  for i, c := range b {
+    s[i] = fmt.Sprintf("%02x", c)
+  }
+  return strings.Join(s, " ")
+}
+
+// envelope prints the version, call or reply that starts the payload, if any
+func (d *dumper) envelope() error {
+  if d.decoder.v1 {
+    return d.envelopeV1()
+  }
+  if len(d.b) < 3 || d.b[0] != 0x48 || d.b[1] != 0x02 || d.b[2] != 0x00 {
+    return nil
+  }
+  start := d.decoder.offset
+  d.decoder.readVersion()
+  if err := d.line(start, 0, "version 2.0"); err != nil {
+    return err
+  }
+  start = d.decoder.offset
+  code, err := d.decoder.read()
+  if err != nil {
+    return d.decoder.unexpectedEOF(err, "call or reply")
+  }
+  switch code {
+  case 0x43:
+    method, err := d.decoder.ReadString()
+    if err != nil {
+      return d.decoder.unexpectedEOF(err, "method")
+    }
+    size, err := d.decoder.ReadInt()
+    if err != nil {
+      return d.decoder.unexpectedEOF(err, "argument count")
+    }
+    return d.line(start, 0, "call %s args=%d", method, size)
+  case 0x52:
+    return d.line(start, 0, "reply")
+  case 0x46:
+    return d.line(start, 0, "fault")
+  }
+  return d.decoder.syntaxError(start, code, "call or reply")
+}
+
+func (d *dumper) envelopeV1() error {
+  if len(d.b) < 3 || d.b[0] != 0x63 && d.b[0] != 0x72 || d.b[1] != 0x01 || d.b[2] != 0x00 {
+    return nil
+  }
+  start := d.decoder.offset
+  code, _ := d.decoder.read()
+  d.decoder.readn(2)
+  kind := "call"
+  if code == 0x72 {
+    kind = "reply"
+  }
+  if err := d.line(start, 0, "%s 1.0", kind); err != nil {
+    return err
+  }
+  for {
+    start = d.decoder.offset
+    code, err := d.decoder.peek()
+    if err != nil {
+      return d.decoder.unexpectedEOF(err, kind)
+    }
+    switch {
+    case code == 0x48 || code == 0x6d && kind == "call":
+      d.decoder.read()
+      bits, err := d.decoder.readn(2)
+      if err != nil {
+        return d.decoder.unexpectedEOF(err, kind)
+      }
+      name, err := d.decoder.read_n_char(int(bits[0])<<8 + int(bits[1]))
+      if err != nil {
+        return d.decoder.unexpectedEOF(err, kind)
+      }
+      if code == 0x6d {
+        return d.line(start, 0, "method %s", name)
+      }
+      if err := d.line(start, 1, "header %s", name); err != nil {
+        return err
+      }
+      if err := d.value(2, ""); err != nil {
+        return err
+      }
+    case code == 0x66 && kind == "reply":
+      d.decoder.read()
+      return d.line(start, 0, "fault")
+    default:
+      return nil
+    }
+  }
+}
+
+// a container printed by value, the values of an object are labeled by its
+// fields and map values are indented below their key
+type dumpFrame struct {
+  depth int
+  fields []string
+  isMap bool
+  n int // values printed so far
+}
+
+// value prints the next value and the values it holds at depth, token by token
+func (d *dumper) value(depth int, label string) error {
+  decoder := d.decoder
+  var frames []dumpFrame
+  level := len(decoder.tokens)
+  for {
+    start := decoder.offset
+    end := false
+    if len(decoder.tokens) > level {
+      var err error
+      if end, err = decoder.atTokenEnd(); err != nil {
+        return d.valueError(err, level)
+      }
+    }
+    lineDepth, lineLabel := depth, label
+    if n := len(frames); n > 0 {
+      frame := &frames[n - 1]
+      lineDepth, lineLabel = frame.depth + 1, ""
+      switch {
+      case frame.fields != nil && frame.n < len(frame.fields):
+        lineLabel = frame.fields[frame.n] + ": "
+      case frame.isMap && frame.n % 2 == 1:
+        lineDepth++
+      }
+    }
+    if !end {
+      code, err := decoder.peek()
+      if err != nil {
+        return d.valueError(err, level)
+      }
+      // the 'z' ending a 1.0 call or reply
+      if decoder.v1 && code == 0x7a && len(decoder.tokens) == level {
+        decoder.read()
+        return d.line(start, depth, "%send", label)
+      }
+      // the class definitions before an object
+      for code == 0x43 && !decoder.v1 {
+        def, err := decoder.ReadClassDef()
+        if err != nil {
+          return d.valueError(err, level)
+        }
+        err = d.line(start, lineDepth, "class %s [%s] def=%d", def.ValueType, strings.Join(def.Fields, " "), len(decoder.classDefs) - 1)
+        if err != nil {
+          return err
+        }
+        start = decoder.offset
+        if code, err = decoder.peek(); err != nil {
+          return decoder.unexpectedEOF(err, "object")
+        }
+      }
+    }
+    token, err := decoder.Token()
+    if err != nil {
+      return d.valueError(err, level)
+    }
+    parent := len(frames) - 1
+    switch t := token.(type) {
+    case End:
+      // only 'Z' is printed, fixed-length containers end without it
+      if decoder.offset > start {
+        err = d.line(start, frames[parent].depth, "end")
+      }
+      frames = frames[:parent]
+    case ListStart:
+      if t.Len < 0 {
+        err = d.line(start, lineDepth, "%slist %s #%d", lineLabel, t.Type, decoder.refId - 1)
+      } else {
+        err = d.line(start, lineDepth, "%slist %s size=%d #%d", lineLabel, t.Type, t.Len, decoder.refId - 1)
+      }
+      frames = append(frames, dumpFrame{depth: lineDepth})
+    case MapStart:
+      typeName := t.Type
+      if typeName != "" {
+        typeName += " "
+      }
+      err = d.line(start, lineDepth, "%smap %s#%d", lineLabel, typeName, decoder.refId - 1)
+      frames = append(frames, dumpFrame{depth: lineDepth, isMap: true})
+    case ObjectStart:
+      err = d.line(start, lineDepth, "%sobject %s #%d", lineLabel, t.Class, decoder.refId - 1)
+      frames = append(frames, dumpFrame{depth: lineDepth, fields: t.Fields})
+    case Ref:
+      err = d.line(start, lineDepth, "%sref #%d", lineLabel, t.ID)
+    default:
+      err = d.line(start, lineDepth, "%s%s", lineLabel, dumpScalar(t))
+    }
+    if err != nil {
+      return err
+    }
+    if _, ok := token.(End); !ok && parent >= 0 {
+      frames[parent].n++
+    }
+    if len(decoder.tokens) == level {
+      return nil
+    }
+  }
+}
+
+// valueError reports a value cut short inside a container as unexpected eof
+func (d *dumper) valueError(err error, level int) error {
+  if len(d.decoder.tokens) > level {
+    return d.decoder.unexpectedEOF(err, "value")
+  }
+  return err
+}
+
+func dumpScalar(v interface{}) string {
+  switch value := v.(type) {
+  case nil:
+    return "null"
+  case bool:
+    return fmt.Sprintf("bool %t", value)
+  case int32:
+    return fmt.Sprintf("int %d", value)
+  case int64:
+    return fmt.Sprintf("long %d", value)
+  case float64:
+    return fmt.Sprintf("double %v", value)
+  case string:
+    return fmt.Sprintf("string %q", value)
+  case time.Time:
+    return "date " + value.UTC().Format(time.RFC3339Nano)
+  case []byte:
+    s := hex.EncodeToString(value)
+    if len(s) > 64 {
+      s = s[:64] + "..."
+    }
+    return fmt.Sprintf("binary len=%d %s", len(value), s)
+  }
+  return fmt.Sprintf("%T %v", v, v)
+}
+
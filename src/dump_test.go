@@ -0,0 +1,58 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "strings"
+  "testing"
+)
+
+func TestDump(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteReply(Object{"example.Car", []string{"color", "ids"}, []interface{}{"red", []int32{1, 70000}}})
+  var out bytes.Buffer
+  err := Dump(&out, encoder.Bytes(), DumpOptions{})
+  unexpected_error(err, t)
+  expect := strings.Join([]string{
+    "000000  48  version 2.0",
+    "000003  52  reply",
+    "000004  43  class example.Car [color ids] def=0",
+    "00001c  60  object example.Car #0",
+    "00001d  03    color: string \"red\"",
+    "000021  72    ids: list [int size=2 #1",
+    "000027  91      int 1",
+    "000028  d5      int 70000",
+    "",
+  }, "\n")
+  if out.String() != expect {
+    t.Errorf("dump: expect\n%s\nfound\n%s", expect, out.String())
+  }
+
+  out.Reset()
+  err = Dump(&out, []byte{0x57, 0x91, 0x02, 0x61, 0x62, 0x5a}, DumpOptions{Hex: true})
+  unexpected_error(err, t)
+  lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+  if len(lines) != 4 || !strings.HasPrefix(lines[2], "000002  02 61 62") || !strings.HasSuffix(lines[2], "  string \"ab\"") {
+    t.Errorf("dump: hex error, found\n%s", out.String())
+  }
+
+  // the lines before a malformed value are written
+  out.Reset()
+  err = Dump(&out, []byte{0x79, 0x91, 0x49, 0x00}, DumpOptions{})
+  if !errors.Is(err, ErrUnexpectedEOF) || !strings.Contains(out.String(), "int 1") {
+    t.Errorf("dump: expect unexpected eof after the first value, found %v\n%s", err, out.String())
+  }
+}
+
+func TestDumpV1(t *testing.T) {
+  // c x01 x00 m "add" I 1 z
+  code := append([]byte{0x63, 0x01, 0x00}, v1Chunk(0x6d, "add")...)
+  code = append(code, 0x49, 0, 0, 0, 1, 0x7a)
+  var out bytes.Buffer
+  err := Dump(&out, code, DumpOptions{V1: true})
+  unexpected_error(err, t)
+  expect := "000000  63  call 1.0\n000003  6d  method add\n000009  49  int 1\n00000e  7a  end\n"
+  if out.String() != expect {
+    t.Errorf("dump: expect\n%s\nfound\n%s", expect, out.String())
+  }
+}
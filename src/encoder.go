@@ -0,0 +1,564 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "fmt"
+  "math"
+  "reflect"
+  "sort"
+  "time"
+  "unicode/utf16"
+)
+
+type Encoder struct {
+  buf *bytes.Buffer
+  types map[string]int32
+  classDefs map[string]int32
+  refs map[refKey]int32 // lists, maps and objects written by pointer
+  refId int32
+  v1 bool // hessian 1.0 output, see NewEncoderV1
+}
+
+// identity of a pointer or map value
+type refKey struct {
+  ptr uintptr
+  t reflect.Type
+}
+
+func NewEncoder() *Encoder {
+  return &Encoder{
+    buf: bytes.NewBuffer(nil),
+    types: make(map[string]int32),
+    classDefs: make(map[string]int32),
+    refs: make(map[refKey]int32),
+  }
+}
+
+// Bytes returns the encoded data, it is valid until the next write
+func (encoder *Encoder) Bytes() []byte {
+  return encoder.buf.Bytes()
+}
+
+func (encoder *Encoder) write(bits ...byte) {
+  encoder.buf.Write(bits)
+}
+
+/**
+ * int ::= 'I' b3 b2 b1 b0
+ *     ::= [x80-xbf]
+ *     ::= [xc0-xcf] b0
+ *     ::= [xd0-xd7] b1 b0
+ */
+func (encoder *Encoder) WriteInt(v int32) error {
+  switch {
+  case encoder.v1:
+    encoder.write(0x49)
+    encoder.write(int32ToBytes(v)...)
+  case v >= -0x10 && v <= 0x2f:
+    encoder.write(byte(v + 0x90))
+  case v >= -0x800 && v <= 0x7ff:
+    encoder.write(byte(0xc8 + v>>8), byte(v))
+  case v >= -0x40000 && v <= 0x3ffff:
+    encoder.write(byte(0xd4 + v>>16), byte(v>>8), byte(v))
+  default:
+    encoder.write(0x49)
+    encoder.write(int32ToBytes(v)...)
+  }
+  return nil
+}
+
+/**
+ * long ::= L b7 b6 b5 b4 b3 b2 b1 b0
+ *      ::= [xd8-xef]
+ *      ::= [xf0-xff] b0
+ *      ::= [x38-x3f] b1 b0
+ *      ::= x59 b3 b2 b1 b0
+ */
+func (encoder *Encoder) WriteLong(v int64) error {
+  switch {
+  case encoder.v1:
+    encoder.write(0x4c)
+    encoder.write(int64ToBytes(v)...)
+  case v >= -0x08 && v <= 0x0f:
+    encoder.write(byte(v + 0xe0))
+  case v >= -0x800 && v <= 0x7ff:
+    encoder.write(byte(0xf8 + v>>8), byte(v))
+  case v >= -0x40000 && v <= 0x3ffff:
+    encoder.write(byte(0x3c + v>>16), byte(v>>8), byte(v))
+  case v >= math.MinInt32 && v <= math.MaxInt32:
+    encoder.write(0x59)
+    encoder.write(int32ToBytes(int32(v))...)
+  default:
+    encoder.write(0x4c)
+    encoder.write(int64ToBytes(v)...)
+  }
+  return nil
+}
+
+/**
+ *   double ::= D b7 b6 b5 b4 b3 b2 b1 b0
+ *          ::= x5b
+ *          ::= x5c
+ *          ::= x5d b0
+ *          ::= x5e b1 b0
+ *          ::= x5f b3 b2 b1 b0
+ */
+func (encoder *Encoder) WriteDouble(v float64) error {
+  switch {
+  case encoder.v1:
+    encoder.write(0x44)
+    encoder.write(float64ToBytes(v)...)
+  case v == 0:
+    encoder.write(0x5b)
+  case v == 1:
+    encoder.write(0x5c)
+  case v >= math.MinInt8 && v <= math.MaxInt8 && v == math.Trunc(v):
+    encoder.write(0x5d, byte(int8(v)))
+  case v >= math.MinInt16 && v <= math.MaxInt16 && v == math.Trunc(v):
+    i := int16(v)
+    encoder.write(0x5e, byte(i>>8), byte(i))
+  case v*1000 >= math.MinInt32 && v*1000 <= math.MaxInt32 && 0.001*float64(int32(v*1000)) == v:
+    // same as java Hessian2Output: the int is the value in thousandths
+    encoder.write(0x5f)
+    encoder.write(int32ToBytes(int32(v * 1000))...)
+  default:
+    encoder.write(0x44)
+    encoder.write(float64ToBytes(v)...)
+  }
+  return nil
+}
+
+func (encoder *Encoder) WriteBoolean(v bool) error {
+  if v {
+    encoder.write(0x54)
+  } else {
+    encoder.write(0x46)
+  }
+  return nil
+}
+
+/**
+ * string ::= x52 b1 b0 <utf8-data> string
+ *        ::= S b1 b0 <utf8-data>
+ *        ::= [x00-x1f] <utf8-data>
+ *        ::= [x30-x33] b0 <utf8-data>
+ */
+func (encoder *Encoder) WriteString(v string) error {
+  // lengths count utf-16 code units like java string lengths
+  units := utf16.Encode([]rune(v))
+  chunk := byte(0x52)
+  if encoder.v1 {
+    chunk = 0x73
+  }
+  for len(units) > 0x8000 {
+    n := 0x8000
+    // a surrogate pair is not split between chunks
+    if isHighSurrogate(units[n - 1]) {
+      n--
+    }
+    encoder.write(chunk, byte(n>>8), byte(n))
+    encoder.writeChars(units[:n])
+    units = units[n:]
+  }
+  switch {
+  case encoder.v1:
+    encoder.write(0x53, byte(len(units)>>8), byte(len(units)))
+  case len(units) <= 0x1f:
+    encoder.write(byte(len(units)))
+  case len(units) <= 0x3ff:
+    encoder.write(byte(0x30 + len(units)>>8), byte(len(units)))
+  default:
+    encoder.write(0x53, byte(len(units)>>8), byte(len(units)))
+  }
+  encoder.writeChars(units)
+  return nil
+}
+
+// writeChars writes utf-16 code units as java does, each surrogate of a
+// supplementary character is a 3-byte sequence (cesu-8)
+func (encoder *Encoder) writeChars(units []uint16) {
+  for _, u := range units {
+    switch {
+    case u < 0x80:
+      encoder.buf.WriteByte(byte(u))
+    case u < 0x800:
+      encoder.buf.WriteByte(byte(0xc0 | u>>6))
+      encoder.buf.WriteByte(byte(0x80 | u & 0x3f))
+    default:
+      encoder.buf.WriteByte(byte(0xe0 | u>>12))
+      encoder.buf.WriteByte(byte(0x80 | u>>6 & 0x3f))
+      encoder.buf.WriteByte(byte(0x80 | u & 0x3f))
+    }
+  }
+}
+
+/**
+ * binary ::= x41 b1 b0 <binary-data> binary
+ *        ::= B(final_chunk) b1 b0 <binary-data>
+ *        ::= [x20-x2f] <binary-data>
+ */
+func (encoder *Encoder) WriteBinary(v []byte) error {
+  if len(v) <= 0x0f && !encoder.v1 {
+    encoder.write(byte(0x20 + len(v)))
+    encoder.write(v...)
+    return nil
+  }
+  chunk := byte(0x41)
+  if encoder.v1 {
+    chunk = 0x62
+  }
+  for len(v) > 0x8000 {
+    encoder.write(chunk, 0x80, 0x00)
+    encoder.write(v[:0x8000]...)
+    v = v[0x8000:]
+  }
+  encoder.write(0x42, byte(len(v)>>8), byte(len(v)))
+  encoder.write(v...)
+  return nil
+}
+
+/**
+ * date ::= x4a b7 b6 b5 b4 b3 b2 b1 b0
+ *      ::= x4b b3 b2 b1 b0 // minutes since epoch
+ */
+func (encoder *Encoder) WriteDate(v time.Time) error {
+  // UnixNano overflows outside the years 1678 to 2262
+  ms := v.Unix() * 1000 + int64(v.Nanosecond() / 1e6)
+  minutes := ms / 60000
+  if encoder.v1 {
+    encoder.write(0x64)
+    encoder.write(int64ToBytes(ms)...)
+    return nil
+  }
+  if ms % 60000 == 0 && minutes >= math.MinInt32 && minutes <= math.MaxInt32 {
+    encoder.write(0x4b)
+    encoder.write(int32ToBytes(int32(minutes))...)
+    return nil
+  }
+  encoder.write(0x4a)
+  encoder.write(int64ToBytes(ms)...)
+  return nil
+}
+
+func (encoder *Encoder) WriteNull() error {
+  encoder.write(0x4e)
+  return nil
+}
+
+/**
+ * ref ::= x51 int
+ */
+func (encoder *Encoder) WriteRef(ref int32) error {
+  if encoder.v1 {
+    encoder.write(0x52)
+    encoder.write(int32ToBytes(ref)...)
+    return nil
+  }
+  encoder.write(0x51)
+  return encoder.WriteInt(ref)
+}
+
+// writeRefOf writes a ref when the pointer or map v was written before,
+// otherwise v is recorded under the number of the container written next
+func (encoder *Encoder) writeRefOf(v reflect.Value) bool {
+  key := refKey{v.Pointer(), v.Type()}
+  if ref, ok := encoder.refs[key]; ok {
+    encoder.WriteRef(ref)
+    return true
+  }
+  encoder.refs[key] = encoder.refId
+  return false
+}
+
+/**
+ * type ::= string
+ *      ::= int(type-ref)
+ */
+func (encoder *Encoder) writeType(typeName string) error {
+  if encoder.v1 {
+    return encoder.writeTypeV1(typeName)
+  }
+  if ref, ok := encoder.types[typeName]; ok {
+    return encoder.WriteInt(ref)
+  }
+  encoder.types[typeName] = int32(len(encoder.types))
+  return encoder.WriteString(typeName)
+}
+
+/**
+list ::= 'V' type int value*   # fixed-length list
+     ::= x58 int value*        # fixed-length untyped list
+     ::= [x70-77] type value*  # fixed-length typed list
+     ::= [x78-7f] value*       # fixed-length untyped list
+*/
+func (encoder *Encoder) WriteList(v List) error {
+  encoder.refId++
+  typeName := v.ValueType
+  if typeName == UNTYPED {
+    typeName = ""
+  }
+  encoder.writeListHeader(typeName, len(v.Value))
+  for _, item := range v.Value {
+    if err := encoder.WriteValue(item); err != nil {
+      return err
+    }
+  }
+  encoder.writeListEnd()
+  return nil
+}
+
+// writeListHeader writes a list up to its first value,
+// typeName is empty for untyped lists
+func (encoder *Encoder) writeListHeader(typeName string, size int) {
+  switch {
+  case encoder.v1:
+    encoder.writeListHeaderV1(typeName, size)
+  case typeName == "" && size <= 7:
+    encoder.write(byte(0x78 + size))
+  case typeName == "":
+    encoder.write(0x58)
+    encoder.WriteInt(int32(size))
+  case size <= 7:
+    encoder.write(byte(0x70 + size))
+    encoder.writeType(typeName)
+  default:
+    encoder.write(0x56)
+    encoder.writeType(typeName)
+    encoder.WriteInt(int32(size))
+  }
+}
+
+// writeVariableListHeader writes a list that ends with 'Z', or 'z' in
+// hessian 1.0, typeName is empty for untyped lists
+func (encoder *Encoder) writeVariableListHeader(typeName string) {
+  switch {
+  case encoder.v1:
+    encoder.write(0x56)
+    encoder.writeTypeV1(typeName)
+  case typeName == "":
+    encoder.write(0x57)
+  default:
+    encoder.write(0x55)
+    encoder.writeType(typeName)
+  }
+}
+
+// hessian 2.0 lists written here have a fixed length, 1.0 lists end with 'z'
+func (encoder *Encoder) writeListEnd() {
+  if encoder.v1 {
+    encoder.write(0x7a)
+  }
+}
+
+// writeMapHeader writes 'H', or 'M' with the type of a typed map
+func (encoder *Encoder) writeMapHeader(typeName string) {
+  if typeName == "" && !encoder.v1 {
+    encoder.write(0x48)
+    return
+  }
+  encoder.write(0x4d)
+  encoder.writeType(typeName)
+}
+
+func (encoder *Encoder) writeMapEnd() {
+  if encoder.v1 {
+    encoder.write(0x7a)
+  } else {
+    encoder.write(0x5a)
+  }
+}
+
+// write untyped map, keys are written in a stable order
+func (encoder *Encoder) WriteMap(v map[interface{}]interface{}) error {
+  keys := make([]interface{}, 0, len(v))
+  for k := range v {
+    keys = append(keys, k)
+  }
+  sort.Slice(keys, func(i, j int) bool {
+    return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+  })
+  encoder.refId++
+  encoder.writeMapHeader("")
+  for _, k := range keys {
+    if err := encoder.WriteValue(k); err != nil {
+      return err
+    }
+    if err := encoder.WriteValue(v[k]); err != nil {
+      return err
+    }
+  }
+  encoder.writeMapEnd()
+  return nil
+}
+
+func (encoder *Encoder) WriteTypedMap(v TypedMap) error {
+  keys := make([]string, 0, len(v.Value))
+  for k := range v.Value {
+    keys = append(keys, k)
+  }
+  sort.Strings(keys)
+  encoder.refId++
+  encoder.writeMapHeader(v.ValueType)
+  for _, k := range keys {
+    encoder.WriteString(k)
+    if err := encoder.WriteValue(v.Value[k]); err != nil {
+      return err
+    }
+  }
+  encoder.writeMapEnd()
+  return nil
+}
+
+/**
+ * class-def ::= 'C' string int string*
+ * the definition is written once per class name. hessian 1.0 has no class
+ * definitions, objects are written as typed maps of their fields
+ */
+func (encoder *Encoder) writeObjectHeader(className string, fields []string) {
+  if encoder.v1 {
+    encoder.writeMapHeader(className)
+    return
+  }
+  ref, ok := encoder.classDefs[className]
+  if !ok {
+    ref = int32(len(encoder.classDefs))
+    encoder.classDefs[className] = ref
+    encoder.write(0x43)
+    encoder.WriteString(className)
+    encoder.WriteInt(int32(len(fields)))
+    for _, name := range fields {
+      encoder.WriteString(name)
+    }
+  }
+  if ref <= 0x0f {
+    encoder.write(byte(0x60 + ref))
+  } else {
+    encoder.write(0x4f)
+    encoder.WriteInt(ref)
+  }
+}
+
+/**
+ * object ::= 'O' int value*
+ *        ::= [x60-x6f] value*
+ */
+func (encoder *Encoder) WriteObject(v Object) error {
+  if len(v.Value) != len(v.Fields) {
+    return errors.New("writeObject error: field count mismatch")
+  }
+  encoder.refId++
+  encoder.writeObjectHeader(v.ValueType, v.Fields)
+  for i, item := range v.Value {
+    if encoder.v1 {
+      encoder.WriteString(v.Fields[i])
+    }
+    if err := encoder.WriteValue(item); err != nil {
+      return err
+    }
+  }
+  encoder.writeObjectEnd()
+  return nil
+}
+
+// writeObjectEnd ends the typed map of a 1.0 object
+func (encoder *Encoder) writeObjectEnd() {
+  if encoder.v1 {
+    encoder.write(0x7a)
+  }
+}
+
+// WriteValue writes v with the writer matching its go type,
+// int and int64 are written as long, smaller integers as int.
+// a pointer to a list, typed map or object and a map that was
+// written before is written as ref, nil ones as null, a RawMessage as it is
+func (encoder *Encoder) WriteValue(v interface{}) error {
+  switch value := v.(type) {
+  case nil:
+    return encoder.WriteNull()
+  case bool:
+    return encoder.WriteBoolean(value)
+  case int8:
+    return encoder.WriteInt(int32(value))
+  case int16:
+    return encoder.WriteInt(int32(value))
+  case int32:
+    return encoder.WriteInt(value)
+  case uint8:
+    return encoder.WriteInt(int32(value))
+  case uint16:
+    return encoder.WriteInt(int32(value))
+  case int:
+    return encoder.WriteLong(int64(value))
+  case int64:
+    return encoder.WriteLong(value)
+  case uint32:
+    return encoder.WriteLong(int64(value))
+  case float32:
+    return encoder.WriteDouble(float64(value))
+  case float64:
+    return encoder.WriteDouble(value)
+  case string:
+    return encoder.WriteString(value)
+  case []byte:
+    return encoder.WriteBinary(value)
+  case RawMessage:
+    return encoder.WriteRaw(value)
+  case time.Time:
+    return encoder.WriteDate(value)
+  case List:
+    return encoder.WriteList(value)
+  case *List:
+    if value == nil {
+      return encoder.WriteNull()
+    }
+    if encoder.writeRefOf(reflect.ValueOf(value)) {
+      return nil
+    }
+    return encoder.WriteList(*value)
+  case []interface{}:
+    return encoder.WriteList(List{UNTYPED, value})
+  case TypedMap:
+    return encoder.WriteTypedMap(value)
+  case *TypedMap:
+    if value == nil {
+      return encoder.WriteNull()
+    }
+    if encoder.writeRefOf(reflect.ValueOf(value)) {
+      return nil
+    }
+    return encoder.WriteTypedMap(*value)
+  case Object:
+    return encoder.WriteObject(value)
+  case *Object:
+    if value == nil {
+      return encoder.WriteNull()
+    }
+    if encoder.writeRefOf(reflect.ValueOf(value)) {
+      return nil
+    }
+    return encoder.WriteObject(*value)
+  case map[interface{}]interface{}:
+    if value == nil {
+      return encoder.WriteNull()
+    }
+    if encoder.writeRefOf(reflect.ValueOf(value)) {
+      return nil
+    }
+    return encoder.WriteMap(value)
+  case map[string]interface{}:
+    if value == nil {
+      return encoder.WriteNull()
+    }
+    if encoder.writeRefOf(reflect.ValueOf(value)) {
+      return nil
+    }
+    m := make(map[interface{}]interface{}, len(value))
+    for k, item := range value {
+      m[k] = item
+    }
+    return encoder.WriteMap(m)
+  }
+  // structs, like the values of registered classes, and other go values
+  return encoder.Encode(v)
+}
@@ -0,0 +1,280 @@
+package hessian
+
+import (
+  "bytes"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestWriteInt(t *testing.T) {
+  cases := []struct {
+    value int32
+    code []byte
+  }{
+    {0, []byte{0x90}},
+    {-16, []byte{0x80}},
+    {47, []byte{0xbf}},
+    {-2048, []byte{0xc0, 0x00}},
+    {2047, []byte{0xcf, 0xff}},
+    {-262144, []byte{0xd0, 0x00, 0x00}},
+    {262143, []byte{0xd7, 0xff, 0xff}},
+    {2147483647, []byte{0x49, 0x7f, 0xff, 0xff, 0xff}},
+    {-2147483648, []byte{0x49, 0x80, 0x00, 0x00, 0x00}},
+  }
+  for _, c := range cases {
+    encoder := NewEncoder()
+    encoder.WriteInt(c.value)
+    if !bytes.Equal(encoder.Bytes(), c.code) {
+      t.Errorf("writeInt: %d should be encoded to %x found %x", c.value, c.code, encoder.Bytes())
+    }
+    n, err := NewDecoder(encoder.Bytes()).ReadInt()
+    unexpected_error(err, t)
+    if n != c.value {
+      t.Errorf("writeInt: expect %d found %d", c.value, n)
+    }
+  }
+}
+
+func TestWriteLong(t *testing.T) {
+  cases := []struct {
+    value int64
+    code []byte
+  }{
+    {0, []byte{0xe0}},
+    {-8, []byte{0xd8}},
+    {15, []byte{0xef}},
+    {-1024, []byte{0xf4, 0x00}},
+    {-262144, []byte{0x38, 0x00, 0x00}},
+    {-2147483648, []byte{0x59, 0x80, 0x00, 0x00, 0x00}},
+    {2147483648, []byte{0x4c, 0x00, 0x00, 0x00, 0x00, 0x80, 0x00, 0x00, 0x00}},
+  }
+  for _, c := range cases {
+    encoder := NewEncoder()
+    encoder.WriteLong(c.value)
+    if !bytes.Equal(encoder.Bytes(), c.code) {
+      t.Errorf("writeLong: %d should be encoded to %x found %x", c.value, c.code, encoder.Bytes())
+    }
+    n, err := NewDecoder(encoder.Bytes()).ReadLong()
+    unexpected_error(err, t)
+    if n != c.value {
+      t.Errorf("writeLong: expect %d found %d", c.value, n)
+    }
+  }
+}
+
+func TestWriteDouble(t *testing.T) {
+  cases := []struct {
+    value float64
+    code []byte
+  }{
+    {0, []byte{0x5b}},
+    {1, []byte{0x5c}},
+    {-128, []byte{0x5d, 0x80}},
+    {32767, []byte{0x5e, 0x7f, 0xff}},
+    {12.25, []byte{0x5f, 0x00, 0x00, 0x2f, 0xda}},
+    {1.1234567, []byte{0x44, 0x3f, 0xf1, 0xf9, 0xad, 0xbb, 0x8f, 0x8d, 0xa7}},
+  }
+  for _, c := range cases {
+    encoder := NewEncoder()
+    encoder.WriteDouble(c.value)
+    if !bytes.Equal(encoder.Bytes(), c.code) {
+      t.Errorf("writeDouble: %f should be encoded to %x found %x", c.value, c.code, encoder.Bytes())
+    }
+    f, err := NewDecoder(encoder.Bytes()).ReadDouble()
+    unexpected_error(err, t)
+    if f != c.value {
+      t.Errorf("writeDouble: expect %f found %f", c.value, f)
+    }
+  }
+}
+
+func TestWriteString(t *testing.T) {
+  {
+    encoder := NewEncoder()
+    encoder.WriteString("你好")
+    code := []byte{0x02, 0xe4, 0xbd, 0xa0, 0xe5, 0xa5, 0xbd}
+    if !bytes.Equal(encoder.Bytes(), code) {
+      t.Errorf("writeString: encoder error")
+    }
+  }
+  for _, size := range []int{0, 31, 32, 1023, 1024, 0x8000, 0x8001} {
+    s := strings.Repeat("a", size)
+    encoder := NewEncoder()
+    encoder.WriteString(s)
+    ret, err := NewDecoder(encoder.Bytes()).ReadString()
+    unexpected_error(err, t)
+    if ret != s {
+      t.Errorf("writeString: string of length %d not decoded back", size)
+    }
+  }
+}
+
+func TestWriteStringUTF16(t *testing.T) {
+  {
+    // java writes a surrogate pair as two 3-byte sequences and counts two chars
+    encoder := NewEncoder()
+    encoder.WriteString("a\U0001F600b")
+    code := []byte{0x04, 0x61, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0x62}
+    if !bytes.Equal(encoder.Bytes(), code) {
+      t.Errorf("writeString: expect %x found %x", code, encoder.Bytes())
+    }
+  }
+  {
+    // the pair at the chunk boundary goes to the next chunk
+    s := strings.Repeat("a", 0x7fff) + "\U0001F600b"
+    encoder := NewEncoder()
+    encoder.WriteString(s)
+    code := encoder.Bytes()
+    if code[0] != 0x52 || code[1] != 0x7f || code[2] != 0xff {
+      t.Errorf("writeString: expect chunk of 0x7fff found %x", code[:3])
+    }
+    ret, err := NewDecoder(code).ReadString()
+    unexpected_error(err, t)
+    if ret != s {
+      t.Errorf("writeString: string with surrogate pair not decoded back")
+    }
+  }
+}
+
+func TestWriteBinary(t *testing.T) {
+  for _, size := range []int{0, 15, 16, 0x8000, 0x8001} {
+    b := bytes.Repeat([]byte{0x01}, size)
+    encoder := NewEncoder()
+    encoder.WriteBinary(b)
+    ret, err := NewDecoder(encoder.Bytes()).ReadBinary()
+    unexpected_error(err, t)
+    if !bytes.Equal(ret, b) {
+      t.Errorf("writeBinary: binary of length %d not decoded back", size)
+    }
+  }
+  // non-final chunks are 'A', java reads 'b' as a compact object
+  b := bytes.Repeat([]byte{0x01}, 0x10001)
+  encoder := NewEncoder()
+  encoder.WriteBinary(b)
+  code := encoder.Bytes()
+  if code[0] != 0x41 || code[0x8003] != 0x41 || code[0x10006] != 0x42 {
+    t.Errorf("writeBinary: expect chunks 41 41 42 found %x %x %x", code[0], code[0x8003], code[0x10006])
+  }
+  ret, err := NewDecoder(code).ReadValue()
+  unexpected_error(err, t)
+  if bits, ok := ret.([]byte); !ok || !bytes.Equal(bits, b) {
+    t.Errorf("writeBinary: binary of 3 chunks not decoded back")
+  }
+}
+
+func TestWriteDate(t *testing.T) {
+  {
+    encoder := NewEncoder()
+    encoder.WriteDate(time.Unix(0, 1504067708366 * 1e6))
+    code := []byte{0x4a, 0x00, 0x00, 0x01, 0x5e, 0x31, 0x6b, 0xe5, 0xce}
+    if !bytes.Equal(encoder.Bytes(), code) {
+      t.Errorf("writeDate: encoder error")
+    }
+  }
+  {
+    encoder := NewEncoder()
+    encoder.WriteDate(time.Unix(11724480 * 60, 0))
+    code := []byte{0x4b, 0x00, 0xb2, 0xe6, 0xc0}
+    if !bytes.Equal(encoder.Bytes(), code) {
+      t.Errorf("writeDate: encoder error")
+    }
+  }
+  // dates past the range of UnixNano
+  for _, date := range []time.Time{
+    time.Date(2500, 1, 1, 0, 0, 0, 0, time.UTC),
+    time.Date(2500, 1, 1, 0, 0, 1, 5e6, time.UTC),
+    time.Date(1500, 6, 30, 12, 0, 0, 0, time.UTC),
+    time.Date(1500, 6, 30, 12, 0, 0, 250e6, time.UTC),
+  } {
+    for _, encoder := range []*Encoder{NewEncoder(), NewEncoderV1()} {
+      encoder.WriteDate(date)
+      decoder := NewDecoder(encoder.Bytes())
+      if encoder.v1 {
+        decoder = NewDecoderV1(encoder.Bytes())
+      }
+      ret, err := decoder.ReadDate()
+      unexpected_error(err, t)
+      if !ret.Equal(date) {
+        t.Errorf("writeDate: expect %v found %v", date, ret)
+      }
+    }
+  }
+}
+
+func TestWriteBooleanAndNull(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteBoolean(true)
+  encoder.WriteBoolean(false)
+  encoder.WriteNull()
+  if !bytes.Equal(encoder.Bytes(), []byte{0x54, 0x46, 0x4e}) {
+    t.Errorf("writeBoolean: encoder error")
+  }
+}
+
+func TestWriteNilValues(t *testing.T) {
+  var m map[string]interface{}
+  var untyped map[interface{}]interface{}
+  values := []interface{}{(*List)(nil), (*TypedMap)(nil), (*Object)(nil), m, m, untyped, untyped}
+  encoder := NewEncoder()
+  for _, v := range values {
+    unexpected_error(encoder.WriteValue(v), t)
+  }
+  if !bytes.Equal(encoder.Bytes(), bytes.Repeat([]byte{0x4e}, len(values))) {
+    t.Errorf("writeValue: nil values expect null found %x", encoder.Bytes())
+  }
+}
+
+func TestWriteList(t *testing.T) {
+  {
+    encoder := NewEncoder()
+    encoder.WriteList(List{"[int", []interface{}{int32(1), int32(-1), int32(65536)}})
+    code := []byte{0x73, 0x04, 0x5b, 0x69, 0x6e, 0x74, 0x91, 0x8f, 0xd5, 0x00, 0x00}
+    if !bytes.Equal(encoder.Bytes(), code) {
+      t.Errorf("writeList: encoder error, found %x", encoder.Bytes())
+    }
+  }
+  {
+    value := []interface{}{}
+    for i := 0; i < 10; i++ {
+      value = append(value, "hello")
+    }
+    encoder := NewEncoder()
+    encoder.WriteList(List{"string", value})
+    ret, err := NewDecoder(encoder.Bytes()).ReadList()
+    unexpected_error(err, t)
+    if ret.ValueType != "string" || len(ret.Value) != 10 {
+      t.Errorf("writeList: encoder error")
+    }
+  }
+}
+
+func TestWriteMap(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteMap(map[interface{}]interface{}{
+    int32(1): "hello",
+    int32(2): "hello",
+  })
+  code := []byte{0x48,0x91,0x05,0x68,0x65,0x6C,0x6C,0x6F,0x92,0x05,0x68,0x65,0x6C,0x6C,0x6F,0x5A}
+  if !bytes.Equal(encoder.Bytes(), code) {
+    t.Errorf("writeMap: encoder error, found %x", encoder.Bytes())
+  }
+}
+
+func TestWriteTypedMap(t *testing.T) {
+  encoder := NewEncoder()
+  value := TypedMap{"PlainObject", map[string]interface{}{"name": "ysp", "value": int32(123)}}
+  encoder.WriteTypedMap(value)
+  encoder.WriteTypedMap(value)
+  decoder := NewDecoder(encoder.Bytes())
+  for i := 0; i < 2; i++ {
+    ret, err := decoder.ReadTypedMap()
+    unexpected_error(err, t)
+    if ret.ValueType != "PlainObject" {
+      t.Errorf("writeTypedMap: expect %s found %s", "PlainObject", ret.ValueType)
+    }
+    if ret.Value["name"] != "ysp" || ret.Value["value"] != int32(123) {
+      t.Errorf("writeTypedMap: encoder error")
+    }
+  }
+}
@@ -0,0 +1,89 @@
+package hessian
+
+import (
+  "unicode/utf16"
+)
+
+// NewEncoderV1 returns an encoder writing hessian 1.0, like java HessianOutput.
+// the Write methods take the same values as for hessian 2.0
+func NewEncoderV1() *Encoder {
+  encoder := NewEncoder()
+  encoder.v1 = true
+  return encoder
+}
+
+// writeLenStringV1 writes tag, the length of s and s, as the
+// type of lists and maps and the method of calls
+func (encoder *Encoder) writeLenStringV1(tag byte, s string) {
+  units := utf16.Encode([]rune(s))
+  encoder.write(tag, byte(len(units)>>8), byte(len(units)))
+  encoder.writeChars(units)
+}
+
+/**
+ * type ::= t b1 b0 type-string
+ * hessian 1.0 has no type refs, untyped values have no type
+ */
+func (encoder *Encoder) writeTypeV1(typeName string) error {
+  if typeName != "" {
+    encoder.writeLenStringV1(0x74, typeName)
+  }
+  return nil
+}
+
+/**
+ * list ::= V type? length? value* z
+ * length ::= l b3 b2 b1 b0
+ */
+func (encoder *Encoder) writeListHeaderV1(typeName string, size int) {
+  encoder.write(0x56)
+  encoder.writeTypeV1(typeName)
+  encoder.write(0x6c)
+  encoder.write(int32ToBytes(int32(size))...)
+}
+
+/**
+ * call ::= c x01 x00 m b1 b0 method-string value* z
+ */
+func (encoder *Encoder) writeCallV1(method string, args []interface{}) error {
+  encoder.write(0x63, 0x01, 0x00)
+  encoder.writeLenStringV1(0x6d, method)
+  for _, arg := range args {
+    if err := encoder.Encode(arg); err != nil {
+      return err
+    }
+  }
+  encoder.write(0x7a)
+  return nil
+}
+
+/**
+ * reply ::= r x01 x00 value z
+ */
+func (encoder *Encoder) writeReplyV1(v interface{}) error {
+  encoder.write(0x72, 0x01, 0x00)
+  if err := encoder.Encode(v); err != nil {
+    return err
+  }
+  encoder.write(0x7a)
+  return nil
+}
+
+/**
+ * reply ::= r x01 x00 f (value value)* z
+ */
+func (encoder *Encoder) writeFaultV1(fields map[interface{}]interface{}) error {
+  encoder.write(0x72, 0x01, 0x00, 0x66)
+  for _, k := range []string{"code", "message", "detail"} {
+    v, ok := fields[k]
+    if !ok {
+      continue
+    }
+    encoder.WriteString(k)
+    if err := encoder.Encode(v); err != nil {
+      return err
+    }
+  }
+  encoder.write(0x7a)
+  return nil
+}
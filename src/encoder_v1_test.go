@@ -0,0 +1,80 @@
+package hessian
+
+import (
+  "bytes"
+  "reflect"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestEncoderV1Primitives(t *testing.T) {
+  tests := []struct {
+    value interface{}
+    code []byte
+  }{
+    {int32(1), []byte{0x49, 0, 0, 0, 1}},
+    {int64(1), []byte{0x4c, 0, 0, 0, 0, 0, 0, 0, 1}},
+    {float64(1), []byte{0x44, 0x3f, 0xf0, 0, 0, 0, 0, 0, 0}},
+    {"go", v1Chunk(0x53, "go")},
+    {[]byte{1}, []byte{0x42, 0, 1, 1}},
+    {time.Unix(0, 1e6), []byte{0x64, 0, 0, 0, 0, 0, 0, 0, 1}},
+    {List{UNTYPED, []interface{}{true}}, []byte{0x56, 0x6c, 0, 0, 0, 1, 0x54, 0x7a}},
+  }
+  for _, test := range tests {
+    encoder := NewEncoderV1()
+    unexpected_error(encoder.WriteValue(test.value), t)
+    if !bytes.Equal(encoder.Bytes(), test.code) {
+      t.Errorf("encoderV1: %v expect %x found %x", test.value, test.code, encoder.Bytes())
+    }
+  }
+}
+
+func TestEncoderV1RoundTrip(t *testing.T) {
+  car := &unmarshalCar{Color: "red", Model: "corvette", Mileage: 65536}
+  values := []interface{}{
+    strings.Repeat("a", 0x8001),
+    bytes.Repeat([]byte{1}, 0x8001),
+    []int32{1, 2},
+    map[interface{}]interface{}{"a": int32(1)},
+    TypedMap{"com.acme.Car", map[string]interface{}{"color": "red"}},
+  }
+  for _, v := range values {
+    encoder := NewEncoderV1()
+    unexpected_error(encoder.WriteValue(v), t)
+    ret, err := NewDecoderV1(encoder.Bytes()).ReadValue()
+    unexpected_error(err, t)
+    if m, ok := ret.(*TypedMap); ok {
+      ret = *m
+    }
+    if !reflect.DeepEqual(ret, v) {
+      t.Errorf("encoderV1: expect %v found %v", v, ret)
+    }
+  }
+
+  // structs are written as typed maps, refs as R
+  encoder := NewEncoderV1()
+  unexpected_error(encoder.Encode([]*unmarshalCar{car, car}), t)
+  var cars []*unmarshalCar
+  unexpected_error(NewDecoderV1(encoder.Bytes()).Decode(&cars), t)
+  if len(cars) != 2 || *cars[0] != *car || cars[0] != cars[1] {
+    t.Errorf("encoderV1: structs decode error, found %v", cars)
+  }
+}
+
+func TestEncoderV1Call(t *testing.T) {
+  encoder := NewEncoderV1()
+  unexpected_error(encoder.WriteCall("add", int32(1)), t)
+  method, args, err := NewDecoderV1(encoder.Bytes()).ReadCall()
+  unexpected_error(err, t)
+  if method != "add" || !reflect.DeepEqual(args, []interface{}{int32(1)}) {
+    t.Errorf("encoderV1: call decode error, found %s %v", method, args)
+  }
+  encoder = NewEncoderV1()
+  unexpected_error(encoder.WriteReply("ok"), t)
+  v, err := NewDecoderV1(encoder.Bytes()).ReadReply()
+  unexpected_error(err, t)
+  if v != "ok" {
+    t.Errorf("encoderV1: reply expect ok found %v", v)
+  }
+}
@@ -0,0 +1,133 @@
+package hessian
+
+import (
+  "errors"
+  "fmt"
+  "io"
+)
+
+var (
+  // matched by errors.Is for all malformed input
+  ErrSyntax = errors.New("hessian: syntax error")
+  // matched by errors.Is when the input ends inside a value
+  ErrUnexpectedEOF = errors.New("hessian: unexpected EOF")
+  // matched by errors.Is for all exceeded DecoderOptions limits
+  ErrLimit = errors.New("hessian: limit exceeded")
+  // matched by errors.Is for the limit of the same DecoderOptions field
+  ErrMaxDepth = errors.New("hessian: max depth exceeded")
+  ErrMaxListLen = errors.New("hessian: max list length exceeded")
+  ErrMaxStringLen = errors.New("hessian: max string length exceeded")
+  ErrMaxBinaryLen = errors.New("hessian: max binary length exceeded")
+  ErrMaxTotalBytes = errors.New("hessian: max total bytes exceeded")
+  ErrMaxRefs = errors.New("hessian: max refs exceeded")
+  // matched by errors.Is for class names rejected by a ClassPolicy
+  ErrPolicy = errors.New("hessian: class rejected by policy")
+)
+
+// SyntaxError is returned when a tag byte can not start what is expected
+type SyntaxError struct {
+  Offset int64 // offset of the tag byte in the input
+  Tag byte
+  Expected string // what was expected at Offset, like "int" or "string"
+}
+
+func (e *SyntaxError) Error() string {
+  return fmt.Sprintf("hessian: unexpected tag 0x%02x at offset %d, %s expected", e.Tag, e.Offset, e.Expected)
+}
+
+func (e *SyntaxError) Is(target error) bool {
+  return target == ErrSyntax
+}
+
+// UnexpectedEOFError is returned when the input ends inside a value,
+// ending right before a value is reported as io.EOF instead
+type UnexpectedEOFError struct {
+  Offset int64 // offset where the input ended
+  Expected string
+}
+
+func (e *UnexpectedEOFError) Error() string {
+  return fmt.Sprintf("hessian: unexpected EOF at offset %d, %s expected", e.Offset, e.Expected)
+}
+
+func (e *UnexpectedEOFError) Is(target error) bool {
+  return target == ErrUnexpectedEOF || target == io.ErrUnexpectedEOF
+}
+
+// ReferenceError is returned for a ref, type-ref or class definition
+// index that was not defined before
+type ReferenceError struct {
+  Offset int64 // offset of the value holding the index
+  Kind string // "ref", "type" or "class definition"
+  Index int32
+}
+
+func (e *ReferenceError) Error() string {
+  return fmt.Sprintf("hessian: unknown %s %d at offset %d", e.Kind, e.Index, e.Offset)
+}
+
+func (e *ReferenceError) Is(target error) bool {
+  return target == ErrSyntax
+}
+
+// EncodingError is returned for string data that is neither utf-8 nor cesu-8,
+// or whose surrogates do not pair up
+type EncodingError struct {
+  Offset int64 // offset of the invalid sequence
+  Reason string
+}
+
+func (e *EncodingError) Error() string {
+  return fmt.Sprintf("hessian: invalid utf-8 data at offset %d: %s", e.Offset, e.Reason)
+}
+
+func (e *EncodingError) Is(target error) bool {
+  return target == ErrSyntax
+}
+
+// LimitError is returned when the input exceeds a limit of DecoderOptions
+type LimitError struct {
+  Offset int64 // offset where the limit was exceeded
+  Limit error // ErrMaxDepth, ErrMaxListLen or another limit sentinel
+  Max int64 // the limit
+}
+
+func (e *LimitError) Error() string {
+  return fmt.Sprintf("%s at offset %d, limit %d", e.Limit, e.Offset, e.Max)
+}
+
+func (e *LimitError) Is(target error) bool {
+  return target == ErrLimit || target == e.Limit
+}
+
+// PolicyError is returned for a class name rejected by the ClassPolicy
+// of DecoderOptions
+type PolicyError struct {
+  Offset int64 // offset of the class name
+  Class string
+  Reason error // the error of ClassPolicy.Check, or why the lists rejected it
+}
+
+func (e *PolicyError) Error() string {
+  return fmt.Sprintf("hessian: class %s at offset %d rejected: %v", e.Class, e.Offset, e.Reason)
+}
+
+func (e *PolicyError) Is(target error) bool {
+  return target == ErrPolicy
+}
+
+func (e *PolicyError) Unwrap() error {
+  return e.Reason
+}
+
+func (decoder *Decoder) syntaxError(offset int64, code byte, expected string) error {
+  return &SyntaxError{offset, code, expected}
+}
+
+// turns io.EOF inside a value into *UnexpectedEOFError, other errors are kept
+func (decoder *Decoder) unexpectedEOF(err error, expected string) error {
+  if err == io.EOF || err == io.ErrUnexpectedEOF {
+    return &UnexpectedEOFError{decoder.offset, expected}
+  }
+  return err
+}
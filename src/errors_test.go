@@ -0,0 +1,63 @@
+package hessian
+
+import (
+  "errors"
+  "io"
+  "testing"
+)
+
+func TestSyntaxError(t *testing.T) {
+  // [1, 'A'] the second value has an unknown code
+  decoder := NewDecoder([]byte{0x7a, 0x91, 0x40})
+  _, err := decoder.ReadValue()
+  var syntaxError *SyntaxError
+  if !errors.As(err, &syntaxError) || !errors.Is(err, ErrSyntax) {
+    t.Fatalf("readValue: expect syntax error found %v", err)
+  }
+  if syntaxError.Offset != 2 || syntaxError.Tag != 0x40 || syntaxError.Expected != "value" {
+    t.Errorf("readValue: unexpected syntax error %+v", syntaxError)
+  }
+  {
+    _, err := NewDecoder([]byte{0x90, 0x05}).ReadString()
+    if !errors.As(err, &syntaxError) || syntaxError.Tag != 0x90 || syntaxError.Expected != "string" {
+      t.Errorf("readString: unexpected error %v", err)
+    }
+  }
+}
+
+func TestUnexpectedEOFError(t *testing.T) {
+  {
+    _, err := NewDecoder([]byte{}).ReadValue()
+    if err != io.EOF {
+      t.Errorf("readValue: expect io.EOF found %v", err)
+    }
+  }
+  {
+    // untyped list of 3 values with only one value
+    _, err := NewDecoder([]byte{0x7b, 0x91}).ReadValue()
+    var eofError *UnexpectedEOFError
+    if !errors.As(err, &eofError) || !errors.Is(err, ErrUnexpectedEOF) || errors.Is(err, ErrSyntax) {
+      t.Fatalf("readValue: expect unexpected EOF found %v", err)
+    }
+    if eofError.Offset != 2 {
+      t.Errorf("readValue: expect offset 2 found %d", eofError.Offset)
+    }
+  }
+  {
+    _, err := NewDecoder([]byte{0x4c, 0x00, 0x01}).ReadLong()
+    if !errors.Is(err, ErrUnexpectedEOF) {
+      t.Errorf("readLong: expect unexpected EOF found %v", err)
+    }
+  }
+}
+
+func TestReferenceError(t *testing.T) {
+  _, err := NewDecoder([]byte{0x51, 0x92}).ReadValue()
+  var refError *ReferenceError
+  if !errors.As(err, &refError) || !errors.Is(err, ErrSyntax) {
+    t.Fatalf("readRef: expect reference error found %v", err)
+  }
+  if refError.Kind != "ref" || refError.Index != 2 || refError.Offset != 1 {
+    t.Errorf("readRef: unexpected reference error %+v", refError)
+  }
+}
@@ -0,0 +1,766 @@
+package hessian
+
+import (
+  "bytes"
+  "encoding/base64"
+  "encoding/json"
+  "fmt"
+  "io"
+  "math"
+  "reflect"
+  "sort"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// JSONConvention sets how ToJSON writes the hessian values json has no type
+// for, and how FromJSON reads them back. with the default "$" prefix
+//
+//   long       {"$long": "12"}
+//   double     {"$double": 1}, only for integral and non-finite values
+//   date       {"$date": "2017-08-30T04:35:08.366Z"}
+//   binary     {"$binary": "base64"}
+//   typed list {"$type": "[int", "$list": [1, 2]}
+//   map        {"key": value}, or {"$map": [[key, value]]} for keys that are not strings
+//   typed map  {"$type": "com.acme.Config", "$map": {"key": value}}
+//   object     {"$type": "com.acme.Order", "field": value}, "$$field" for "$field"
+//   ref        {"$ref": 0} to the list, map or object with "$id": 0
+//   call       {"$call": "method", "$args": [value]}
+//   reply      {"$reply": value} or {"$fault": map}
+//
+// untyped lists are arrays, ints, doubles, strings, booleans and null are
+// json values
+type JSONConvention struct {
+  // Prefix starts the annotation keys, "$" when empty
+  Prefix string
+  // PlainLongs writes longs as json numbers, FromJSON reads the numbers
+  // that fit in 32 bits back as int
+  PlainLongs bool
+  // UnixDates writes dates as milliseconds since the epoch instead of
+  // RFC 3339 strings, FromJSON reads both
+  UnixDates bool
+  // Options bounds the hessian read by ToJSON
+  Options DecoderOptions
+}
+
+// DefaultJSONConvention is the convention of ToJSON and FromJSON
+var DefaultJSONConvention = JSONConvention{Prefix: "$"}
+
+// ToJSON converts the hessian value, call or reply in data to json
+// annotated with DefaultJSONConvention
+func ToJSON(data []byte) ([]byte, error) {
+  return DefaultJSONConvention.ToJSON(data)
+}
+
+// FromJSON converts json annotated with DefaultJSONConvention back to hessian
+func FromJSON(data []byte) ([]byte, error) {
+  return DefaultJSONConvention.FromJSON(data)
+}
+
+func (convention JSONConvention) key(name string) string {
+  if convention.Prefix == "" {
+    return "$" + name
+  }
+  return convention.Prefix + name
+}
+
+// ToJSON converts the hessian value, call or reply in data to json. class
+// registrations are ignored, values keep the java type they are written with
+func (convention JSONConvention) ToJSON(data []byte) ([]byte, error) {
+  decoder := NewDecoder(data)
+  decoder.SetOptions(convention.Options)
+  w := &jsonWriter{convention: convention, counts: make(map[uintptr]int), ids: make(map[uintptr]int)}
+  var err error
+  if len(data) >= 3 && data[0] == 0x48 && data[1] == 0x02 && data[2] == 0x00 {
+    err = w.envelope(decoder)
+  } else {
+    var v interface{}
+    if v, err = decoder.readValue(); err == nil {
+      w.count(v)
+      err = w.value(v)
+    }
+  }
+  if err != nil {
+    return nil, err
+  }
+  if _, err := decoder.peek(); err != io.EOF {
+    return nil, fmt.Errorf("hessian: trailing data at offset %d: %w", decoder.offset, ErrSyntax)
+  }
+  return w.buf.Bytes(), nil
+}
+
+type jsonWriter struct {
+  convention JSONConvention
+  buf bytes.Buffer
+  counts map[uintptr]int // occurrences of each list, map and object
+  ids map[uintptr]int
+}
+
+// envelope writes the call or reply following the version header
+func (w *jsonWriter) envelope(decoder *Decoder) error {
+  decoder.readVersion()
+  code, err := decoder.read()
+  if err != nil {
+    return decoder.unexpectedEOF(err, "call or reply")
+  }
+  switch code {
+  case 0x43:
+    method, err := decoder.ReadString()
+    if err != nil {
+      return decoder.unexpectedEOF(err, "method")
+    }
+    size, err := decoder.ReadInt()
+    if err != nil {
+      return decoder.unexpectedEOF(err, "argument count")
+    }
+    if size < 0 {
+      return fmt.Errorf("hessian: negative argument count %d at offset %d: %w", size, decoder.offset, ErrSyntax)
+    }
+    if err := decoder.checkListLen(int(size)); err != nil {
+      return err
+    }
+    args := make([]interface{}, 0, preallocSize(int(size)))
+    for i := int32(0); i < size; i++ {
+      arg, err := decoder.readValue()
+      if err != nil {
+        return decoder.unexpectedEOF(err, "argument")
+      }
+      args = append(args, arg)
+    }
+    for _, arg := range args {
+      w.count(arg)
+    }
+    w.buf.WriteString("{")
+    w.string(w.convention.key("call"))
+    w.buf.WriteString(":")
+    w.string(method)
+    w.buf.WriteString(",")
+    w.string(w.convention.key("args"))
+    w.buf.WriteString(":")
+    if err := w.values(args); err != nil {
+      return err
+    }
+    w.buf.WriteString("}")
+    return nil
+  case 0x52, 0x46:
+    v, err := decoder.readValue()
+    if err != nil {
+      return decoder.unexpectedEOF(err, "reply value")
+    }
+    w.count(v)
+    name := "reply"
+    if code == 0x46 {
+      name = "fault"
+    }
+    return w.annotated(name, v)
+  }
+  return decoder.syntaxError(decoder.offset - 1, code, "call or reply")
+}
+
+// count walks v once and counts how often each container is met
+func (w *jsonWriter) count(v interface{}) {
+  var children []interface{}
+  switch value := v.(type) {
+  case *List:
+    children = value.Value
+  case *Object:
+    children = value.Value
+  case *TypedMap:
+    for _, item := range value.Value {
+      children = append(children, item)
+    }
+  case map[interface{}]interface{}:
+    for k, item := range value {
+      children = append(children, k, item)
+    }
+  default:
+    return
+  }
+  ptr := reflect.ValueOf(v).Pointer()
+  w.counts[ptr]++
+  if w.counts[ptr] > 1 {
+    return
+  }
+  for _, child := range children {
+    w.count(child)
+  }
+}
+
+func (w *jsonWriter) string(s string) {
+  b, _ := json.Marshal(s)
+  w.buf.Write(b)
+}
+
+// annotated writes {"$name": v}
+func (w *jsonWriter) annotated(name string, v interface{}) error {
+  w.buf.WriteString("{")
+  w.string(w.convention.key(name))
+  w.buf.WriteString(":")
+  if err := w.value(v); err != nil {
+    return err
+  }
+  w.buf.WriteString("}")
+  return nil
+}
+
+func (w *jsonWriter) values(values []interface{}) error {
+  w.buf.WriteString("[")
+  for i, item := range values {
+    if i > 0 {
+      w.buf.WriteString(",")
+    }
+    if err := w.value(item); err != nil {
+      return err
+    }
+  }
+  w.buf.WriteString("]")
+  return nil
+}
+
+// open starts the json object of a container, it writes a ref instead
+// and reports false when the container was written before
+func (w *jsonWriter) open(v interface{}) bool {
+  ptr := reflect.ValueOf(v).Pointer()
+  if id, ok := w.ids[ptr]; ok {
+    fmt.Fprintf(&w.buf, "{%s:%d}", strconv.Quote(w.convention.key("ref")), id)
+    return false
+  }
+  w.buf.WriteString("{")
+  if w.counts[ptr] > 1 {
+    w.ids[ptr] = len(w.ids)
+    fmt.Fprintf(&w.buf, "%s:%d,", strconv.Quote(w.convention.key("id")), w.ids[ptr])
+  }
+  return true
+}
+
+// close ends the json object started by open, dropping a trailing comma
+func (w *jsonWriter) close() {
+  if b := w.buf.Bytes(); b[len(b) - 1] == ',' {
+    w.buf.Truncate(w.buf.Len() - 1)
+  }
+  w.buf.WriteString("}")
+}
+
+func (w *jsonWriter) field(name string, v interface{}) error {
+  w.string(name)
+  w.buf.WriteString(":")
+  if err := w.value(v); err != nil {
+    return err
+  }
+  w.buf.WriteString(",")
+  return nil
+}
+
+func (w *jsonWriter) value(v interface{}) error {
+  switch value := v.(type) {
+  case nil:
+    w.buf.WriteString("null")
+  case bool, int32, string:
+    b, _ := json.Marshal(value)
+    w.buf.Write(b)
+  // values of short, byte and float arrays
+  case int8:
+    return w.value(int32(value))
+  case int16:
+    return w.value(int32(value))
+  case float32:
+    return w.value(float64(value))
+  case int64:
+    if w.convention.PlainLongs {
+      w.buf.WriteString(strconv.FormatInt(value, 10))
+      return nil
+    }
+    return w.annotated("long", strconv.FormatInt(value, 10))
+  case float64:
+    if math.IsNaN(value) || math.IsInf(value, 0) {
+      return w.annotated("double", strconv.FormatFloat(value, 'g', -1, 64))
+    }
+    b, _ := json.Marshal(value)
+    if math.Trunc(value) == value {
+      return w.annotated("double", json.RawMessage(b))
+    }
+    w.buf.Write(b)
+  case json.RawMessage:
+    w.buf.Write(value)
+  case time.Time:
+    if w.convention.UnixDates {
+      return w.annotated("date", json.RawMessage(strconv.FormatInt(value.Unix() * 1000 + int64(value.Nanosecond() / 1e6), 10)))
+    }
+    return w.annotated("date", value.UTC().Format(time.RFC3339Nano))
+  case []byte:
+    return w.annotated("binary", base64.StdEncoding.EncodeToString(value))
+  case *List:
+    untyped := value.ValueType == UNTYPED || value.ValueType == ""
+    // a list referred to needs an object for its id
+    if untyped && w.counts[reflect.ValueOf(value).Pointer()] <= 1 {
+      return w.values(value.Value)
+    }
+    if !w.open(value) {
+      return nil
+    }
+    if !untyped {
+      w.field(w.convention.key("type"), value.ValueType)
+    }
+    w.string(w.convention.key("list"))
+    w.buf.WriteString(":")
+    if err := w.values(value.Value); err != nil {
+      return err
+    }
+    w.close()
+  case *TypedMap:
+    if !w.open(value) {
+      return nil
+    }
+    w.field(w.convention.key("type"), value.ValueType)
+    w.string(w.convention.key("map"))
+    w.buf.WriteString(":{")
+    keys := make([]string, 0, len(value.Value))
+    for k := range value.Value {
+      keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    for _, k := range keys {
+      if err := w.field(k, value.Value[k]); err != nil {
+        return err
+      }
+    }
+    w.close()
+    w.buf.WriteString("}")
+  case *Object:
+    if !w.open(value) {
+      return nil
+    }
+    w.field(w.convention.key("type"), value.ValueType)
+    for i, name := range value.Fields {
+      // fields starting with the prefix get another one
+      if strings.HasPrefix(name, w.convention.key("")) {
+        name = w.convention.key(name)
+      }
+      if err := w.field(name, value.Value[i]); err != nil {
+        return err
+      }
+    }
+    w.close()
+  case map[interface{}]interface{}:
+    return w.writeMap(value)
+  default:
+    // java primitive arrays read as go slices
+    rv := reflect.ValueOf(v)
+    if rv.Kind() != reflect.Slice {
+      return fmt.Errorf("hessian: %T has no json form", v)
+    }
+    values := make([]interface{}, rv.Len())
+    for i := range values {
+      values[i] = rv.Index(i).Interface()
+    }
+    return w.value(&List{listTypeName(rv.Type().Elem()), values})
+  }
+  return nil
+}
+
+// writeMap writes a map with string keys as json object, other maps as
+// sorted key value pairs
+func (w *jsonWriter) writeMap(m map[interface{}]interface{}) error {
+  keys := make([]interface{}, 0, len(m))
+  plain := true
+  for k := range m {
+    keys = append(keys, k)
+    s, ok := k.(string)
+    plain = plain && ok && !strings.HasPrefix(s, w.convention.key(""))
+  }
+  sort.Slice(keys, func(i, j int) bool {
+    return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+  })
+  if !w.open(m) {
+    return nil
+  }
+  if plain {
+    for _, k := range keys {
+      if err := w.field(k.(string), m[k]); err != nil {
+        return err
+      }
+    }
+    w.close()
+    return nil
+  }
+  w.string(w.convention.key("map"))
+  w.buf.WriteString(":[")
+  for i, k := range keys {
+    if i > 0 {
+      w.buf.WriteString(",")
+    }
+    w.buf.WriteString("[")
+    if err := w.value(k); err != nil {
+      return err
+    }
+    w.buf.WriteString(",")
+    if err := w.value(m[k]); err != nil {
+      return err
+    }
+    w.buf.WriteString("]")
+  }
+  w.buf.WriteString("]}")
+  return nil
+}
+
+// jsonObject keeps the order of the keys, which is the field order of objects
+type jsonObject struct {
+  keys []string
+  values []interface{}
+}
+
+func (object *jsonObject) get(key string) (interface{}, bool) {
+  for i, k := range object.keys {
+    if k == key {
+      return object.values[i], true
+    }
+  }
+  return nil, false
+}
+
+// parseJSON reads the next json value, objects are read as *jsonObject
+// and numbers as json.Number
+func parseJSON(decoder *json.Decoder) (interface{}, error) {
+  token, err := decoder.Token()
+  if err != nil {
+    return nil, err
+  }
+  switch token {
+  case json.Delim('['):
+    ret := []interface{}{}
+    for decoder.More() {
+      v, err := parseJSON(decoder)
+      if err != nil {
+        return nil, err
+      }
+      ret = append(ret, v)
+    }
+    _, err := decoder.Token()
+    return ret, err
+  case json.Delim('{'):
+    ret := &jsonObject{}
+    for decoder.More() {
+      key, err := decoder.Token()
+      if err != nil {
+        return nil, err
+      }
+      v, err := parseJSON(decoder)
+      if err != nil {
+        return nil, err
+      }
+      ret.keys = append(ret.keys, key.(string))
+      ret.values = append(ret.values, v)
+    }
+    _, err := decoder.Token()
+    return ret, err
+  }
+  return token, nil
+}
+
+// FromJSON converts json annotated with the convention back to hessian.
+// numbers are read as int when they fit in 32 bits, as long when they are
+// integral and as double otherwise
+func (convention JSONConvention) FromJSON(data []byte) ([]byte, error) {
+  decoder := json.NewDecoder(bytes.NewReader(data))
+  decoder.UseNumber()
+  tree, err := parseJSON(decoder)
+  if err != nil {
+    return nil, fmt.Errorf("hessian: invalid json: %w", err)
+  }
+  if _, err := decoder.Token(); err != io.EOF {
+    return nil, fmt.Errorf("hessian: invalid json: trailing data")
+  }
+  r := &jsonReader{convention: convention, refs: make(map[int64]interface{})}
+  encoder := NewEncoder()
+  object, isObject := tree.(*jsonObject)
+  method, isCall := r.annotation(object, "call")
+  args, _ := r.annotation(object, "args")
+  reply, isReply := r.annotation(object, "reply")
+  fault, isFault := r.annotation(object, "fault")
+  switch {
+  case isObject && isCall:
+    name, ok := method.(string)
+    values, isArray := args.([]interface{})
+    if !ok || !isArray {
+      return nil, fmt.Errorf("hessian: json call needs a method string and an args array")
+    }
+    encoder.writeVersion()
+    encoder.write(0x43)
+    encoder.WriteString(name)
+    encoder.WriteInt(int32(len(values)))
+    for _, arg := range values {
+      if err := r.write(encoder, arg); err != nil {
+        return nil, err
+      }
+    }
+  case isObject && isReply:
+    encoder.writeVersion()
+    encoder.write(0x52)
+    err = r.write(encoder, reply)
+  case isObject && isFault:
+    encoder.writeVersion()
+    encoder.write(0x46)
+    err = r.write(encoder, fault)
+  default:
+    err = r.write(encoder, tree)
+  }
+  if err != nil {
+    return nil, err
+  }
+  return encoder.Bytes(), nil
+}
+
+type jsonReader struct {
+  convention JSONConvention
+  refs map[int64]interface{} // containers by their $id
+}
+
+// annotation returns the value of the annotation key name of object
+func (r *jsonReader) annotation(object *jsonObject, name string) (interface{}, bool) {
+  if object == nil {
+    return nil, false
+  }
+  return object.get(r.convention.key(name))
+}
+
+func (r *jsonReader) write(encoder *Encoder, tree interface{}) error {
+  v, err := r.value(tree)
+  if err != nil {
+    return err
+  }
+  return encoder.WriteValue(v)
+}
+
+func jsonError(format string, args ...interface{}) error {
+  return fmt.Errorf("hessian: json: " + format, args...)
+}
+
+// value converts a parsed json value back to the value read by the decoder
+func (r *jsonReader) value(tree interface{}) (interface{}, error) {
+  switch value := tree.(type) {
+  case json.Number:
+    s := string(value)
+    if !strings.ContainsAny(s, ".eE") {
+      n, err := strconv.ParseInt(s, 10, 64)
+      if err != nil {
+        return nil, jsonError("number %s: %v", s, err)
+      }
+      if n >= math.MinInt32 && n <= math.MaxInt32 {
+        return int32(n), nil
+      }
+      return n, nil
+    }
+    return value.Float64()
+  case []interface{}:
+    l := &List{ValueType: UNTYPED}
+    return l, r.listValues(l, value)
+  case *jsonObject:
+    return r.object(value)
+  }
+  return tree, nil
+}
+
+func (r *jsonReader) listValues(l *List, values []interface{}) error {
+  l.Value = make([]interface{}, len(values))
+  for i, item := range values {
+    v, err := r.value(item)
+    if err != nil {
+      return err
+    }
+    l.Value[i] = v
+  }
+  return nil
+}
+
+// register records the container with the $id of object, before its values
+// are read so they can refer back to it
+func (r *jsonReader) register(object *jsonObject, v interface{}) error {
+  id, ok := r.annotation(object, "id")
+  if !ok {
+    return nil
+  }
+  n, err := jsonInt(id)
+  if err != nil {
+    return jsonError("id: %v", err)
+  }
+  r.refs[n] = v
+  return nil
+}
+
+func jsonInt(v interface{}) (int64, error) {
+  switch value := v.(type) {
+  case json.Number:
+    return value.Int64()
+  case string:
+    return strconv.ParseInt(value, 10, 64)
+  }
+  return 0, fmt.Errorf("%v is not an integer", v)
+}
+
+func (r *jsonReader) object(object *jsonObject) (interface{}, error) {
+  if ref, ok := r.annotation(object, "ref"); ok {
+    n, err := jsonInt(ref)
+    if err != nil {
+      return nil, jsonError("ref: %v", err)
+    }
+    v, ok := r.refs[n]
+    if !ok {
+      return nil, jsonError("ref %d to an unknown id", n)
+    }
+    return v, nil
+  }
+  if v, ok := r.annotation(object, "long"); ok {
+    n, err := jsonInt(v)
+    if err != nil {
+      return nil, jsonError("long: %v", err)
+    }
+    return n, nil
+  }
+  if v, ok := r.annotation(object, "double"); ok {
+    var s string
+    switch value := v.(type) {
+    case json.Number:
+      s = string(value)
+    case string:
+      s = value
+    }
+    f, err := strconv.ParseFloat(s, 64)
+    if err != nil {
+      return nil, jsonError("double %v", v)
+    }
+    return f, nil
+  }
+  if v, ok := r.annotation(object, "date"); ok {
+    switch value := v.(type) {
+    case json.Number:
+      ms, err := value.Int64()
+      if err != nil {
+        return nil, jsonError("date: %v", err)
+      }
+      return time.Unix(ms / 1000, ms % 1000 * 1e6), nil
+    case string:
+      t, err := time.Parse(time.RFC3339Nano, value)
+      if err != nil {
+        return nil, jsonError("date: %v", err)
+      }
+      return t, nil
+    }
+    return nil, jsonError("date %v", v)
+  }
+  if v, ok := r.annotation(object, "binary"); ok {
+    s, _ := v.(string)
+    b, err := base64.StdEncoding.DecodeString(s)
+    if err != nil {
+      return nil, jsonError("binary: %v", err)
+    }
+    return b, nil
+  }
+
+  var typeName string
+  if v, ok := r.annotation(object, "type"); ok {
+    if typeName, ok = v.(string); !ok {
+      return nil, jsonError("type %v is not a string", v)
+    }
+  }
+  if v, ok := r.annotation(object, "list"); ok {
+    values, isArray := v.([]interface{})
+    if !isArray {
+      return nil, jsonError("list is not an array")
+    }
+    l := &List{ValueType: UNTYPED}
+    if typeName != "" {
+      l.ValueType = typeName
+    }
+    if err := r.register(object, l); err != nil {
+      return nil, err
+    }
+    return l, r.listValues(l, values)
+  }
+  entries, hasEntries := r.annotation(object, "map")
+  switch {
+  case hasEntries && typeName != "":
+    fields, ok := entries.(*jsonObject)
+    if !ok {
+      return nil, jsonError("typed map entries are not an object")
+    }
+    m := &TypedMap{typeName, make(map[string]interface{}, len(fields.keys))}
+    if err := r.register(object, m); err != nil {
+      return nil, err
+    }
+    for i, k := range fields.keys {
+      v, err := r.value(fields.values[i])
+      if err != nil {
+        return nil, err
+      }
+      m.Value[k] = v
+    }
+    return m, nil
+  case hasEntries:
+    pairs, ok := entries.([]interface{})
+    if !ok {
+      return nil, jsonError("map entries are not an array")
+    }
+    m := make(map[interface{}]interface{}, len(pairs))
+    if err := r.register(object, m); err != nil {
+      return nil, err
+    }
+    for _, pair := range pairs {
+      kv, ok := pair.([]interface{})
+      if !ok || len(kv) != 2 {
+        return nil, jsonError("map entry is not a [key, value] pair")
+      }
+      k, err := r.value(kv[0])
+      if err != nil {
+        return nil, err
+      }
+      if k != nil && !reflect.TypeOf(k).Comparable() {
+        return nil, jsonError("unhashable map key %T", k)
+      }
+      v, err := r.value(kv[1])
+      if err != nil {
+        return nil, err
+      }
+      m[k] = v
+    }
+    return m, nil
+  case typeName != "":
+    o := &Object{ValueType: typeName}
+    if err := r.register(object, o); err != nil {
+      return nil, err
+    }
+    for i, k := range object.keys {
+      prefix := r.convention.key("")
+      switch {
+      case strings.HasPrefix(k, prefix + prefix):
+        k = k[len(prefix):]
+      case k == r.convention.key("type") || k == r.convention.key("id"):
+        continue
+      case strings.HasPrefix(k, prefix):
+        return nil, jsonError("unknown annotation %s in object", k)
+      }
+      v, err := r.value(object.values[i])
+      if err != nil {
+        return nil, err
+      }
+      o.Fields = append(o.Fields, k)
+      o.Value = append(o.Value, v)
+    }
+    return o, nil
+  }
+  m := make(map[interface{}]interface{}, len(object.keys))
+  if err := r.register(object, m); err != nil {
+    return nil, err
+  }
+  for i, k := range object.keys {
+    if k == r.convention.key("id") {
+      continue
+    }
+    v, err := r.value(object.values[i])
+    if err != nil {
+      return nil, err
+    }
+    m[k] = v
+  }
+  return m, nil
+}
@@ -0,0 +1,132 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "math"
+  "strings"
+  "testing"
+  "time"
+)
+
+func TestToJSON(t *testing.T) {
+  item := &Object{"com.acme.Item", []string{"sku", "price"}, []interface{}{"x-1", 12.5}}
+  order := &Object{"com.acme.Order", []string{"id", "items", "first", "created", "ids", "sig"}, nil}
+  order.Value = []interface{}{
+    int64(7),
+    &List{"[com.acme.Item", []interface{}{item}},
+    item,
+    time.Unix(0, 1504067708366 * 1e6),
+    []int32{1, 2},
+    []byte{1, 2, 3},
+  }
+  encoder := NewEncoder()
+  encoder.WriteValue(order)
+  ret, err := ToJSON(encoder.Bytes())
+  unexpected_error(err, t)
+  expect := `{"$type":"com.acme.Order","id":{"$long":"7"},` +
+    `"items":{"$type":"[com.acme.Item","$list":[{"$id":0,"$type":"com.acme.Item","sku":"x-1","price":12.5}]},` +
+    `"first":{"$ref":0},"created":{"$date":"2017-08-30T04:35:08.366Z"},` +
+    `"ids":{"$type":"[int","$list":[1,2]},"sig":{"$binary":"AQID"}}`
+  if string(ret) != expect {
+    t.Errorf("toJSON: expect\n%s\nfound\n%s", expect, ret)
+  }
+
+  // and back to the same bytes
+  code, err := FromJSON(ret)
+  unexpected_error(err, t)
+  if !bytes.Equal(code, encoder.Bytes()) {
+    t.Errorf("fromJSON: expect %x found %x", encoder.Bytes(), code)
+  }
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+  cycle := &List{UNTYPED, []interface{}{int32(1)}}
+  cycle.Value = append(cycle.Value, cycle)
+  values := []interface{}{
+    nil,
+    true,
+    int32(-1),
+    int64(1) << 40,
+    0.5,
+    2.0,
+    math.Inf(-1),
+    "$tring",
+    map[interface{}]interface{}{"a": int32(1), "b": "c"},
+    map[interface{}]interface{}{int32(1): "a", "$b": nil},
+    &TypedMap{"com.acme.Config", map[string]interface{}{"debug": true}},
+    &Object{"com.acme.Price", []string{"$amount", "$$currency"}, []interface{}{int32(1), "CHF"}},
+    time.Date(2500, 1, 1, 0, 0, 1, 5e6, time.UTC),
+    cycle,
+  }
+  for _, convention := range []JSONConvention{DefaultJSONConvention, {Prefix: "@", UnixDates: true}} {
+    for _, v := range values {
+      encoder := NewEncoder()
+      encoder.WriteValue(v)
+      ret, err := convention.ToJSON(encoder.Bytes())
+      unexpected_error(err, t)
+      code, err := convention.FromJSON(ret)
+      unexpected_error(err, t)
+      if !bytes.Equal(code, encoder.Bytes()) {
+        t.Errorf("json: %v expect %x found %x through %s", v, encoder.Bytes(), code, ret)
+      }
+    }
+  }
+  {
+    ret, err := JSONConvention{PlainLongs: true, UnixDates: true}.ToJSON([]byte{0x59, 0x00, 0x00, 0x00, 0x07})
+    unexpected_error(err, t)
+    if string(ret) != "7" {
+      t.Errorf("json: plain long expect 7 found %s", ret)
+    }
+  }
+  {
+    // untyped lists are arrays unless referred to
+    ret, err := ToJSON(encoded(List{UNTYPED, []interface{}{int32(1), List{UNTYPED, nil}}}))
+    unexpected_error(err, t)
+    if string(ret) != "[1,[]]" {
+      t.Errorf("json: untyped list expect [1,[]] found %s", ret)
+    }
+    ret, err = ToJSON(encoded(&Object{"com.acme.Price", []string{"$amount"}, []interface{}{int32(1)}}))
+    unexpected_error(err, t)
+    if string(ret) != `{"$type":"com.acme.Price","$$amount":1}` {
+      t.Errorf("json: prefixed field expect escaped found %s", ret)
+    }
+  }
+}
+
+func TestJSONEnvelope(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteCall("add", int32(1), "a")
+  ret, err := ToJSON(encoder.Bytes())
+  unexpected_error(err, t)
+  if string(ret) != `{"$call":"add","$args":[1,"a"]}` {
+    t.Errorf("toJSON: call error, found %s", ret)
+  }
+  code, err := FromJSON(ret)
+  unexpected_error(err, t)
+  if !bytes.Equal(code, encoder.Bytes()) {
+    t.Errorf("fromJSON: call expect %x found %x", encoder.Bytes(), code)
+  }
+
+  code, err = FromJSON([]byte(`{"$fault": {"code": "ServiceException", "message": "boom"}}`))
+  unexpected_error(err, t)
+  _, err = NewDecoder(code).ReadReply()
+  if fault, ok := err.(*Fault); !ok || fault.Code != "ServiceException" || fault.Message != "boom" {
+    t.Errorf("fromJSON: fault error, found %v", err)
+  }
+
+  // a call with a negative argument count, found by fuzzing
+  if _, err := ToJSON([]byte{0x48, 0x02, 0x00, 0x43, 0x03, 0x30, 0x30, 0x30, 0x83, 0x30}); !errors.Is(err, ErrSyntax) {
+    t.Errorf("toJSON: negative argument count expect %v found %v", ErrSyntax, err)
+  }
+  // a huge count is not allocated ahead
+  if _, err := ToJSON([]byte{0x48, 0x02, 0x00, 0x43, 0x01, 0x61, 0x49, 0x7f, 0xff, 0xff, 0xff}); !errors.Is(err, ErrUnexpectedEOF) {
+    t.Errorf("toJSON: huge argument count expect %v found %v", ErrUnexpectedEOF, err)
+  }
+
+  for _, invalid := range []string{`{"$ref": 3}`, `{"$binary": "!"}`, `[1,`, `{"$type": "x", "$map": [1]}`, `{"$type": "x", "$amount": 1}`} {
+    if _, err := FromJSON([]byte(invalid)); err == nil || !strings.HasPrefix(err.Error(), "hessian: ") {
+      t.Errorf("fromJSON: %s expect error found %v", invalid, err)
+    }
+  }
+}
@@ -0,0 +1,256 @@
+package hessian
+
+import (
+  "fmt"
+  "reflect"
+  "sort"
+  "time"
+)
+
+// implemented by structs to set the java class name of their class definition,
+// the name given to RegisterType or the go type name is used otherwise
+type JavaClass interface {
+  JavaClassName() string
+}
+
+var javaClassType = reflect.TypeOf((*JavaClass)(nil)).Elem()
+
+// Marshal returns the hessian encoding of v, see Encoder.Encode
+func Marshal(v interface{}) ([]byte, error) {
+  encoder := NewEncoder()
+  if err := encoder.Encode(v); err != nil {
+    return nil, err
+  }
+  return encoder.Bytes(), nil
+}
+
+// Encode writes v using reflection. structs are written as objects,
+// slices and arrays as typed lists, maps as untyped maps, time.Time as date.
+// fields tagged with omitempty are written as null when they are empty,
+// struct pointers and maps that were written before are written as ref
+func (encoder *Encoder) Encode(v interface{}) error {
+  return encoder.encodeValue(reflect.ValueOf(v))
+}
+
+func (encoder *Encoder) encodeValue(v reflect.Value) error {
+  if !v.IsValid() {
+    return encoder.WriteNull()
+  }
+  if ok, err := encoder.encodeCustom(v); ok {
+    return err
+  }
+  if v.Type() == rawMessageType {
+    return encoder.WriteRaw(v.Interface().(RawMessage))
+  }
+  switch v.Kind() {
+  case reflect.Ptr, reflect.Interface:
+    if v.IsNil() {
+      return encoder.WriteNull()
+    }
+    if v.Kind() == reflect.Ptr && v.Elem().Kind() == reflect.Struct && v.Type().Elem() != timeType {
+      if encoder.writeRefOf(v) {
+        return nil
+      }
+    }
+    return encoder.encodeValue(v.Elem())
+  case reflect.Bool:
+    return encoder.WriteBoolean(v.Bool())
+  case reflect.Int8, reflect.Int16, reflect.Int32:
+    return encoder.WriteInt(int32(v.Int()))
+  case reflect.Int, reflect.Int64:
+    return encoder.WriteLong(v.Int())
+  case reflect.Uint8, reflect.Uint16:
+    return encoder.WriteInt(int32(v.Uint()))
+  case reflect.Uint, reflect.Uint32, reflect.Uint64:
+    n := v.Uint()
+    if n > 1<<63 - 1 {
+      return fmt.Errorf("encode error: %d overflows long", n)
+    }
+    return encoder.WriteLong(int64(n))
+  case reflect.Float32, reflect.Float64:
+    return encoder.WriteDouble(v.Float())
+  case reflect.String:
+    return encoder.WriteString(v.String())
+  case reflect.Slice:
+    if v.IsNil() {
+      return encoder.WriteNull()
+    }
+    fallthrough
+  case reflect.Array:
+    if v.Type().Elem().Kind() == reflect.Uint8 {
+      bits := make([]byte, v.Len())
+      reflect.Copy(reflect.ValueOf(bits), v)
+      return encoder.WriteBinary(bits)
+    }
+    return encoder.encodeList(v)
+  case reflect.Map:
+    if v.IsNil() {
+      return encoder.WriteNull()
+    }
+    if encoder.writeRefOf(v) {
+      return nil
+    }
+    return encoder.encodeMap(v)
+  case reflect.Struct:
+    switch value := v.Interface().(type) {
+    case List, TypedMap, Object:
+      return encoder.WriteValue(value)
+    }
+    if v.Type() == timeType {
+      return encoder.WriteValue(v.Interface())
+    }
+    return encoder.encodeStruct(v, javaClassName(v))
+  }
+  return fmt.Errorf("encode error: unsupported type %s", v.Type())
+}
+
+func javaClassName(v reflect.Value) string {
+  if v.Type().Implements(javaClassType) {
+    return v.Interface().(JavaClass).JavaClassName()
+  }
+  if v.CanAddr() && v.Addr().Type().Implements(javaClassType) {
+    return v.Addr().Interface().(JavaClass).JavaClassName()
+  }
+  if reflect.PtrTo(v.Type()).Implements(javaClassType) {
+    ptr := reflect.New(v.Type())
+    ptr.Elem().Set(v)
+    return ptr.Interface().(JavaClass).JavaClassName()
+  }
+  if name, ok := registeredName(v.Type()); ok {
+    return name
+  }
+  return v.Type().Name()
+}
+
+// listTypeName returns the hessian type of a list with elements of type t,
+// an empty string for untyped lists
+func listTypeName(t reflect.Type) string {
+  switch t.Kind() {
+  case reflect.Bool:
+    return "[boolean"
+  case reflect.Int8:
+    return "[byte"
+  case reflect.Int16:
+    return "[short"
+  case reflect.Int32, reflect.Uint8, reflect.Uint16:
+    return "[int"
+  case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+    return "[long"
+  case reflect.Float32:
+    return "[float"
+  case reflect.Float64:
+    return "[double"
+  case reflect.String:
+    return "[string"
+  case reflect.Ptr:
+    if t.Elem().Kind() == reflect.Struct {
+      return listTypeName(t.Elem())
+    }
+  case reflect.Slice, reflect.Array:
+    if t.Elem().Kind() == reflect.Uint8 {
+      return ""
+    }
+    if name := listTypeName(t.Elem()); name != "" {
+      return "[" + name
+    }
+  case reflect.Struct:
+    if t == timeType {
+      return "[java.util.Date"
+    }
+    return "[" + javaClassName(reflect.New(t).Elem())
+  }
+  return ""
+}
+
+func (encoder *Encoder) encodeList(v reflect.Value) error {
+  encoder.refId++
+  size := v.Len()
+  encoder.writeListHeader(listTypeName(v.Type().Elem()), size)
+  for i := 0; i < size; i++ {
+    if err := encoder.encodeValue(v.Index(i)); err != nil {
+      return err
+    }
+  }
+  encoder.writeListEnd()
+  return nil
+}
+
+func (encoder *Encoder) encodeMap(v reflect.Value) error {
+  keys := v.MapKeys()
+  sort.Slice(keys, func(i, j int) bool {
+    return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+  })
+  encoder.refId++
+  encoder.writeMapHeader("")
+  for _, k := range keys {
+    if err := encoder.encodeValue(k); err != nil {
+      return err
+    }
+    if err := encoder.encodeValue(v.MapIndex(k)); err != nil {
+      return err
+    }
+  }
+  encoder.writeMapEnd()
+  return nil
+}
+
+func (encoder *Encoder) encodeStruct(v reflect.Value, className string) error {
+  fields := typeFields(v.Type())
+  names := make([]string, 0, len(fields))
+  for _, f := range fields {
+    names = append(names, f.name)
+  }
+  encoder.refId++
+  encoder.writeObjectHeader(className, names)
+  for _, f := range fields {
+    if encoder.v1 {
+      encoder.WriteString(f.name)
+    }
+    value, ok := fieldValue(v, f.index)
+    if !ok || (f.omitEmpty && isEmptyValue(value)) {
+      encoder.WriteNull()
+      continue
+    }
+    if err := encoder.encodeValue(value); err != nil {
+      return err
+    }
+  }
+  encoder.writeObjectEnd()
+  return nil
+}
+
+// like reflect.Value.FieldByIndex, reports false on nil embedded pointers
+func fieldValue(v reflect.Value, index []int) (reflect.Value, bool) {
+  for i, idx := range index {
+    if i > 0 && v.Kind() == reflect.Ptr {
+      if v.IsNil() {
+        return reflect.Value{}, false
+      }
+      v = v.Elem()
+    }
+    v = v.Field(idx)
+  }
+  return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+  switch v.Kind() {
+  case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+    return v.Len() == 0
+  case reflect.Bool:
+    return !v.Bool()
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    return v.Int() == 0
+  case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    return v.Uint() == 0
+  case reflect.Float32, reflect.Float64:
+    return v.Float() == 0
+  case reflect.Interface, reflect.Ptr:
+    return v.IsNil()
+  case reflect.Struct:
+    if v.Type() == timeType {
+      return v.Interface().(time.Time).IsZero()
+    }
+  }
+  return false
+}
@@ -0,0 +1,93 @@
+package hessian
+
+import (
+  "bytes"
+  "testing"
+  "time"
+)
+
+type marshalUser struct {
+  Name string `hessian:"name"`
+  Age int32 `hessian:"age"`
+  Email string `hessian:"email,omitempty"`
+  Roles []string `hessian:"roles"`
+  Friends []*marshalUser `hessian:"friends"`
+  Created time.Time `hessian:"created"`
+  secret string
+}
+
+func (user *marshalUser) JavaClassName() string {
+  return "com.acme.User"
+}
+
+type marshalPoint struct {
+  X int32
+  Y int32
+}
+
+func TestMarshalStruct(t *testing.T) {
+  code, err := Marshal(marshalPoint{1, 2})
+  unexpected_error(err, t)
+  expected := []byte{0x43, 0x0c, 0x6d, 0x61, 0x72, 0x73, 0x68, 0x61, 0x6c, 0x50, 0x6f, 0x69, 0x6e, 0x74, 0x92,
+    0x01, 0x78, 0x01, 0x79, 0x60, 0x91, 0x92}
+  if !bytes.Equal(code, expected) {
+    t.Errorf("marshal: expect %x found %x", expected, code)
+  }
+}
+
+func TestMarshalJavaClassName(t *testing.T) {
+  user := &marshalUser{
+    Name: "ysp",
+    Age: 28,
+    Roles: []string{"admin"},
+    Friends: []*marshalUser{{Name: "foo"}},
+    Created: time.Unix(11724480 * 60, 0),
+    secret: "secret",
+  }
+  code, err := Marshal(user)
+  unexpected_error(err, t)
+  v, err := NewDecoder(code).ReadValue()
+  unexpected_error(err, t)
+  object, ok := v.(*Object)
+  if !ok || object.ValueType != "com.acme.User" || len(object.Fields) != 6 {
+    t.Fatalf("marshal: object encode error")
+  }
+  if email, _ := object.Get("email"); email != nil {
+    t.Errorf("marshal: empty email should be null")
+  }
+  friends, _ := object.Get("friends")
+  if l, ok := friends.(*List); !ok || l.ValueType != "[com.acme.User" || len(l.Value) != 1 {
+    t.Errorf("marshal: typed list encode error")
+  }
+
+  var decoded marshalUser
+  err = Unmarshal(code, &decoded)
+  unexpected_error(err, t)
+  if decoded.Name != "ysp" || decoded.Age != 28 || decoded.Roles[0] != "admin" || decoded.Friends[0].Name != "foo" {
+    t.Errorf("marshal: round trip error, found %+v", decoded)
+  }
+  if !decoded.Created.Equal(user.Created) || decoded.secret != "" {
+    t.Errorf("marshal: round trip error, found %+v", decoded)
+  }
+}
+
+func TestMarshalCollections(t *testing.T) {
+  code, err := Marshal(map[string][]int32{"a": {1, 2}})
+  unexpected_error(err, t)
+  expected := []byte{0x48, 0x01, 0x61, 0x72, 0x04, 0x5b, 0x69, 0x6e, 0x74, 0x91, 0x92, 0x5a}
+  if !bytes.Equal(code, expected) {
+    t.Errorf("marshal: expect %x found %x", expected, code)
+  }
+  var decoded map[string][]int64
+  err = Unmarshal(code, &decoded)
+  unexpected_error(err, t)
+  if len(decoded["a"]) != 2 || decoded["a"][1] != 2 {
+    t.Errorf("marshal: round trip error, found %v", decoded)
+  }
+  {
+    _, err := Marshal(make(chan int))
+    if err == nil {
+      t.Errorf("marshal should return error for unsupported type")
+    }
+  }
+}
@@ -0,0 +1,144 @@
+package hessian
+
+import (
+  "errors"
+  "strings"
+)
+
+// DecoderOptions bounds what a decoder reads from untrusted input,
+// a zero limit is no limit. exceeded limits are returned as *LimitError
+type DecoderOptions struct {
+  // MaxDepth is the nesting of values, a value at the top has depth 1 and
+  // the values in a list, map or object are one deeper than it. it is
+  // DefaultMaxDepth when zero and no limit when negative
+  MaxDepth int
+  // MaxListLen is the number of values of a list, entries of a map, fields
+  // of a class definition and arguments of a call
+  MaxListLen int
+  // MaxStringLen is the length of a string in utf-16 code units, like java
+  // string lengths
+  MaxStringLen int
+  // MaxBinaryLen is the length of a binary in bytes
+  MaxBinaryLen int
+  // MaxTotalBytes is the number of bytes read from the input
+  MaxTotalBytes int64
+  // MaxRefs is the number of lists, maps and objects numbered for refs
+  MaxRefs int
+  // Classes is checked for the class names of typed maps, class definitions
+  // and typed lists, the policy of the zero value accepts all names
+  Classes ClassPolicy
+}
+
+// ClassPolicy decides which java class names a decoder accepts. a pattern is
+// a class name, or a prefix ending with "*" like "com.acme.*". names of
+// hessian types like int and string, and the [ of arrays, are not checked
+type ClassPolicy struct {
+  // Deny rejects the names matching a pattern, before Allow
+  Deny []string
+  // Allow rejects the names matching no pattern, unless it is empty
+  Allow []string
+  // Check is called for the names passing Deny and Allow, the name is
+  // rejected if it returns an error
+  Check func(className string) error
+}
+
+// hessian type names that are no java classes
+var builtinTypeNames = map[string]bool{
+  "boolean": true, "byte": true, "char": true, "short": true, "int": true, "long": true,
+  "float": true, "double": true, "string": true, "date": true, "object": true,
+}
+
+func matchClass(patterns []string, className string) bool {
+  for _, pattern := range patterns {
+    if strings.HasSuffix(pattern, "*") && strings.HasPrefix(className, pattern[:len(pattern) - 1]) || pattern == className {
+      return true
+    }
+  }
+  return false
+}
+
+// checkClass checks the class name read at offset against the class policy
+func (decoder *Decoder) checkClass(offset int64, typeName string) error {
+  policy := decoder.options.Classes
+  className := strings.TrimLeft(typeName, "[")
+  if className == "" || builtinTypeNames[className] {
+    return nil
+  }
+  if matchClass(policy.Deny, className) {
+    return &PolicyError{offset, className, errors.New("denied")}
+  }
+  if len(policy.Allow) > 0 && !matchClass(policy.Allow, className) {
+    return &PolicyError{offset, className, errors.New("not allowed")}
+  }
+  if policy.Check != nil {
+    if err := policy.Check(className); err != nil {
+      return &PolicyError{offset, className, err}
+    }
+  }
+  return nil
+}
+
+// SetOptions sets the limits of the decoder, before it reads anything
+func (decoder *Decoder) SetOptions(options DecoderOptions) {
+  decoder.options = options
+}
+
+// DefaultMaxDepth bounds the nesting of values when DecoderOptions.MaxDepth
+// is zero, deeper input would overflow the stack of the recursive reads
+const DefaultMaxDepth = 1000
+
+// largest capacity allocated ahead for a length read from the input,
+// longer values grow as they are read
+const maxPrealloc = 1024
+
+func preallocSize(n int) int {
+  if n < 0 {
+    return 0
+  }
+  if n > maxPrealloc {
+    return maxPrealloc
+  }
+  return n
+}
+
+func (decoder *Decoder) checkLimit(n int64, max int64, limit error) error {
+  if max > 0 && n > max {
+    return &LimitError{decoder.offset, limit, max}
+  }
+  return nil
+}
+
+// checkDepth checks the depth of the value read next
+func (decoder *Decoder) checkDepth(depth int) error {
+  max := decoder.options.MaxDepth
+  if max == 0 {
+    max = DefaultMaxDepth
+  }
+  return decoder.checkLimit(int64(depth), int64(max), ErrMaxDepth)
+}
+
+func (decoder *Decoder) checkListLen(n int) error {
+  return decoder.checkLimit(int64(n), int64(decoder.options.MaxListLen), ErrMaxListLen)
+}
+
+func (decoder *Decoder) checkStringLen(n int) error {
+  return decoder.checkLimit(int64(n), int64(decoder.options.MaxStringLen), ErrMaxStringLen)
+}
+
+func (decoder *Decoder) checkBinaryLen(n int) error {
+  return decoder.checkLimit(int64(n), int64(decoder.options.MaxBinaryLen), ErrMaxBinaryLen)
+}
+
+// checkTotalBytes checks that n more bytes may be read
+func (decoder *Decoder) checkTotalBytes(n int) error {
+  return decoder.checkLimit(decoder.offset + int64(n), decoder.options.MaxTotalBytes, ErrMaxTotalBytes)
+}
+
+// countRef numbers the next list, map or object
+func (decoder *Decoder) countRef() error {
+  if err := decoder.checkLimit(int64(decoder.refId) + 1, int64(decoder.options.MaxRefs), ErrMaxRefs); err != nil {
+    return err
+  }
+  decoder.refId++
+  return nil
+}
@@ -0,0 +1,201 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "io"
+  "strings"
+  "testing"
+)
+
+func encoded(v interface{}) []byte {
+  encoder := NewEncoder()
+  encoder.WriteValue(v)
+  return encoder.Bytes()
+}
+
+func TestDecoderOptions(t *testing.T) {
+  nested := List{UNTYPED, []interface{}{List{UNTYPED, []interface{}{List{UNTYPED, []interface{}{int32(1)}}}}}}
+  ints := make([]interface{}, 100)
+  for i := range ints {
+    ints[i] = int32(i)
+  }
+  cases := []struct {
+    name string
+    code []byte
+    options DecoderOptions
+    limit error
+  }{
+    {"depth", encoded(nested), DecoderOptions{MaxDepth: 3}, ErrMaxDepth},
+    {"list", encoded(List{UNTYPED, ints}), DecoderOptions{MaxListLen: 99}, ErrMaxListLen},
+    // the length is checked before the values are read
+    {"list header", []byte{0x58, 0x49, 0x7f, 0xff, 0xff, 0xff}, DecoderOptions{MaxListLen: 1000}, ErrMaxListLen},
+    {"variable list", []byte{0x57, 0x91, 0x92, 0x93, 0x5a}, DecoderOptions{MaxListLen: 2}, ErrMaxListLen},
+    {"typed list", encoded([]int32{1, 2, 3}), DecoderOptions{MaxListLen: 2}, ErrMaxListLen},
+    {"map", encoded(map[interface{}]interface{}{"a": int32(1), "b": int32(2)}), DecoderOptions{MaxListLen: 1}, ErrMaxListLen},
+    {"string", encoded(strings.Repeat("a", 0x8001)), DecoderOptions{MaxStringLen: 0x8000}, ErrMaxStringLen},
+    {"binary", encoded(make([]byte, 100)), DecoderOptions{MaxBinaryLen: 99}, ErrMaxBinaryLen},
+    {"total", encoded(List{UNTYPED, ints}), DecoderOptions{MaxTotalBytes: 50}, ErrMaxTotalBytes},
+    {"refs", encoded(nested), DecoderOptions{MaxRefs: 2}, ErrMaxRefs},
+  }
+  for _, c := range cases {
+    decoder := NewDecoder(c.code)
+    decoder.SetOptions(c.options)
+    _, err := decoder.ReadValue()
+    var limitError *LimitError
+    if !errors.As(err, &limitError) || !errors.Is(err, c.limit) || !errors.Is(err, ErrLimit) || errors.Is(err, ErrSyntax) {
+      t.Errorf("decoderOptions: %s expect %v found %v", c.name, c.limit, err)
+    }
+  }
+
+  // values within the limits
+  options := DecoderOptions{MaxDepth: 4, MaxListLen: 100, MaxStringLen: 0x8001, MaxBinaryLen: 100, MaxRefs: 3}
+  for _, v := range []interface{}{nested, List{UNTYPED, ints}, strings.Repeat("a", 0x8001), make([]byte, 100)} {
+    code := encoded(v)
+    decoder := NewDecoder(code)
+    options.MaxTotalBytes = int64(len(code))
+    decoder.SetOptions(options)
+    _, err := decoder.ReadValue()
+    unexpected_error(err, t)
+  }
+
+  // tokens count the depth and refs as well
+  decoder := NewDecoder(encoded(nested))
+  decoder.SetOptions(DecoderOptions{MaxDepth: 2})
+  var err error
+  for err == nil {
+    _, err = decoder.Token()
+  }
+  if !errors.Is(err, ErrMaxDepth) {
+    t.Errorf("decoderOptions: token expect %v found %v", ErrMaxDepth, err)
+  }
+  // the arguments of a call read by ToJSON are bounded like a list
+  call := NewEncoder()
+  call.WriteCall("add", int32(1), int32(2), int32(3))
+  if _, err := (JSONConvention{Options: DecoderOptions{MaxListLen: 2}}).ToJSON(call.Bytes()); !errors.Is(err, ErrMaxListLen) {
+    t.Errorf("decoderOptions: toJSON call expect %v found %v", ErrMaxListLen, err)
+  }
+}
+
+func TestDefaultMaxDepth(t *testing.T) {
+  // lists nested past the stack
+  deep := bytes.Repeat([]byte{0x79}, 3 << 20)
+  _, err := NewDecoder(deep).ReadValue()
+  if !errors.Is(err, ErrMaxDepth) {
+    t.Errorf("maxDepth: expect %v found %v", ErrMaxDepth, err)
+  }
+  if err := NewDecoder(deep).Skip(); !errors.Is(err, ErrMaxDepth) {
+    t.Errorf("maxDepth: skip expect %v found %v", ErrMaxDepth, err)
+  }
+  if _, err := ToJSON(deep); !errors.Is(err, ErrMaxDepth) {
+    t.Errorf("maxDepth: toJSON expect %v found %v", ErrMaxDepth, err)
+  }
+  if err := Dump(io.Discard, deep, DumpOptions{}); !errors.Is(err, ErrMaxDepth) {
+    t.Errorf("maxDepth: dump expect %v found %v", ErrMaxDepth, err)
+  }
+  header := []byte{0xda, 0xbb, 0xc2, 0x00, 0, 0, 0, 0, 0, 0, 0, 1}
+  header = append(header, int32ToBytes(int32(len(deep)))...)
+  if _, err := ReadDubboMessage(io.MultiReader(bytes.NewReader(header), bytes.NewReader(deep))); !errors.Is(err, ErrMaxDepth) {
+    t.Errorf("maxDepth: dubbo expect %v found %v", ErrMaxDepth, err)
+  }
+
+  // a negative depth is no limit
+  code := append(bytes.Repeat([]byte{0x79}, DefaultMaxDepth), 0x4e)
+  if _, err := NewDecoder(code).ReadValue(); !errors.Is(err, ErrMaxDepth) {
+    t.Errorf("maxDepth: expect %v found %v", ErrMaxDepth, err)
+  }
+  decoder := NewDecoder(code)
+  decoder.SetOptions(DecoderOptions{MaxDepth: -1})
+  _, err = decoder.ReadValue()
+  unexpected_error(err, t)
+}
+
+func TestClassPolicy(t *testing.T) {
+  gadget := Object{"com.sun.rowset.JdbcRowSetImpl", []string{"dataSourceName"}, []interface{}{"ldap://example.com/a"}}
+  user := Object{"com.acme.Account", []string{"name"}, []interface{}{"ann"}}
+  deny := ClassPolicy{Deny: []string{"com.sun.*"}}
+  errCheck := errors.New("check")
+  cases := []struct {
+    name string
+    code []byte
+    policy ClassPolicy
+  }{
+    {"object", encoded(gadget), deny},
+    {"typed map", encoded(TypedMap{"com.sun.rowset.JdbcRowSetImpl", map[string]interface{}{}}), deny},
+    {"typed list", encoded(List{"[com.sun.rowset.JdbcRowSetImpl", []interface{}{}}), deny},
+    {"nested", encoded(List{UNTYPED, []interface{}{gadget}}), deny},
+    {"exact deny", encoded(gadget), ClassPolicy{Deny: []string{"com.sun.rowset.JdbcRowSetImpl"}}},
+    {"allow", encoded(gadget), ClassPolicy{Allow: []string{"com.acme.*"}}},
+    {"deny before allow", encoded(user), ClassPolicy{Allow: []string{"com.acme.*"}, Deny: []string{"com.acme.Account"}}},
+    {"check", encoded(user), ClassPolicy{Check: func(string) error { return errCheck }}},
+  }
+  for _, c := range cases {
+    decoder := NewDecoder(c.code)
+    decoder.SetOptions(DecoderOptions{Classes: c.policy})
+    _, err := decoder.ReadValue()
+    var policyError *PolicyError
+    if !errors.As(err, &policyError) || !errors.Is(err, ErrPolicy) || errors.Is(err, ErrSyntax) {
+      t.Errorf("classPolicy: %s expect policy error found %v", c.name, err)
+    }
+  }
+
+  // the callback error is kept
+  decoder := NewDecoder(encoded(user))
+  decoder.SetOptions(DecoderOptions{Classes: ClassPolicy{Check: func(string) error { return errCheck }}})
+  if _, err := decoder.ReadValue(); !errors.Is(err, errCheck) {
+    t.Errorf("classPolicy: check expect %v found %v", errCheck, err)
+  }
+
+  // allowed classes and hessian types pass
+  policy := ClassPolicy{
+    Allow: []string{"com.acme.*"},
+    Deny: []string{"com.sun.*"},
+    Check: func(className string) error {
+      if className == "com.acme.Secret" {
+        return errCheck
+      }
+      return nil
+    },
+  }
+  for _, v := range []interface{}{user, []int32{1, 2}, []string{"a"}, List{"[com.acme.Account", []interface{}{user}}} {
+    decoder := NewDecoder(encoded(v))
+    decoder.SetOptions(DecoderOptions{Classes: policy})
+    _, err := decoder.ReadValue()
+    unexpected_error(err, t)
+  }
+
+  // tokens are checked as well
+  decoder = NewDecoder(encoded(List{UNTYPED, []interface{}{gadget}}))
+  decoder.SetOptions(DecoderOptions{Classes: deny})
+  var err error
+  for err == nil {
+    _, err = decoder.Token()
+  }
+  if !errors.Is(err, ErrPolicy) {
+    t.Errorf("classPolicy: token expect %v found %v", ErrPolicy, err)
+  }
+
+  // the decoders of json, dump and dubbo
+  options := DecoderOptions{Classes: deny}
+  if _, err := (JSONConvention{Options: options}).ToJSON(encoded(gadget)); !errors.Is(err, ErrPolicy) {
+    t.Errorf("classPolicy: toJSON expect %v found %v", ErrPolicy, err)
+  }
+  if err := Dump(io.Discard, encoded(gadget), DumpOptions{Decoder: options}); !errors.Is(err, ErrPolicy) {
+    t.Errorf("classPolicy: dump expect %v found %v", ErrPolicy, err)
+  }
+  var frame bytes.Buffer
+  unexpected_error(WriteDubboRequest(&frame, &DubboRequest{ID: 1, TwoWay: true, Path: "com.acme.Service", Method: "run", Args: []interface{}{gadget}}), t)
+  if _, err := ReadDubboMessageOptions(bytes.NewReader(frame.Bytes()), options); !errors.Is(err, ErrPolicy) {
+    t.Errorf("classPolicy: dubbo expect %v found %v", ErrPolicy, err)
+  }
+
+  // hessian 1.0
+  code := []byte{0x4d, 0x74, 0x00, 0x1d}
+  code = append(code, "com.sun.rowset.JdbcRowSetImpl"...)
+  code = append(code, 0x7a)
+  decoder = NewDecoderV1(code)
+  decoder.SetOptions(DecoderOptions{Classes: deny})
+  if _, err := decoder.ReadValue(); !errors.Is(err, ErrPolicy) {
+    t.Errorf("classPolicy: v1 expect %v found %v", ErrPolicy, err)
+  }
+}
@@ -0,0 +1,169 @@
+package hessian
+
+import (
+  "fmt"
+  "io"
+  "reflect"
+)
+
+// RawMessage is the encoded bytes of a single value, read by ReadRaw without
+// decoding it and written back by WriteRaw. the value stands on its own: the
+// type refs, class definition refs and value refs in it are numbered as if
+// it were the whole stream
+type RawMessage []byte
+
+var rawMessageType = reflect.TypeOf(RawMessage(nil))
+
+// the definitions and containers a value uses, whose numbers depend
+// on what was written before the value
+type rawUse struct {
+  typeRefs bool
+  objects bool
+  refs bool
+}
+
+// fixed reports whether the bytes of a value using use keep their meaning
+// when the stream before them has types, classDefs and refId
+func (use rawUse) fixed(types, classDefs int, refId int32) bool {
+  return !(use.typeRefs && types > 0 || use.objects && classDefs > 0 || use.refs && refId > 0)
+}
+
+// ReadRaw returns the bytes of the next value with its nested values and
+// chunks. they are the exact bytes of the input when the value stands on its
+// own, otherwise the value is written again with the types and class
+// definitions it uses and its refs numbered from 0. it returns an error for a
+// ref to a container outside the value. containers read by ReadRaw are not
+// kept, refs to them cannot be resolved by ReadValue
+func (decoder *Decoder) ReadRaw() (RawMessage, error) {
+  // an outer mark keeps recording, Reset to it still works
+  owned := !decoder.marked
+  mark := decoder.Mark()
+  types, classDefs, refId := len(decoder.types), len(decoder.classDefs), decoder.refId
+  encoder := NewEncoder()
+  encoder.v1 = decoder.v1
+  use, err := copyValue(decoder, encoder)
+  raw := RawMessage(append([]byte{}, decoder.record[mark - decoder.markStart:]...))
+  if owned {
+    decoder.Release()
+  }
+  if err != nil {
+    return nil, err
+  }
+  if !use.fixed(types, classDefs, refId) {
+    return RawMessage(encoder.Bytes()), nil
+  }
+  return raw, nil
+}
+
+// WriteRaw writes raw, unchanged when its bytes keep their meaning after what
+// the encoder wrote before, otherwise with its types, class definitions and
+// refs numbered by the encoder. the containers and definitions of raw are
+// counted, so that the refs the encoder writes next keep their numbering. it
+// returns an error if raw is not a single value or refers outside itself
+func (encoder *Encoder) WriteRaw(raw RawMessage) error {
+  newDecoder := NewDecoder
+  if encoder.v1 {
+    newDecoder = NewDecoderV1
+  }
+  decoder := newDecoder(raw)
+  scratch := NewEncoder()
+  scratch.v1 = encoder.v1
+  use, err := copyValue(decoder, scratch)
+  if err != nil {
+    return fmt.Errorf("hessian: write raw: %w", err)
+  }
+  if _, err := decoder.peek(); err != io.EOF {
+    return fmt.Errorf("hessian: write raw: trailing data at offset %d: %w", decoder.offset, ErrSyntax)
+  }
+  if !use.fixed(len(encoder.types), len(encoder.classDefs), encoder.refId) {
+    // raw was checked, writing it again does not fail
+    _, err := copyValue(newDecoder(raw), encoder)
+    return err
+  }
+  encoder.write(raw...)
+  encoder.refId += decoder.refId
+  // the slots are taken by keys no type or class is named, the encoder
+  // never writes refs to the definitions of raw
+  for range decoder.types {
+    encoder.types[fmt.Sprintf("\x00raw%d", len(encoder.types))] = int32(len(encoder.types))
+  }
+  for range decoder.classDefs {
+    encoder.classDefs[fmt.Sprintf("\x00raw%d", len(encoder.classDefs))] = int32(len(encoder.classDefs))
+  }
+  return nil
+}
+
+// copyValue writes the next value of decoder to encoder token by token, the
+// encoder numbers the types, class definitions and containers of the value
+// after its own. it returns an error at the End of a container opened by
+// Token and for a ref to a container read before the value
+func copyValue(decoder *Decoder, encoder *Encoder) (rawUse, error) {
+  var use rawUse
+  if len(decoder.tokens) > 0 {
+    end, err := decoder.atTokenEnd()
+    if err != nil {
+      return use, err
+    }
+    if end {
+      return use, errSkipEnd
+    }
+  }
+  level := len(decoder.tokens)
+  refBase, encoderBase := decoder.refId, encoder.refId
+  end := byte(0x5a)
+  if encoder.v1 {
+    end = 0x7a
+  }
+  // whether each container opened here ends with 'Z'
+  var ends []bool
+  for {
+    types, offset := len(decoder.types), decoder.offset
+    token, err := decoder.Token()
+    if err != nil {
+      return use, err
+    }
+    switch t := token.(type) {
+    case ListStart:
+      typeName := t.Type
+      if typeName == UNTYPED {
+        typeName = ""
+      }
+      use.typeRefs = use.typeRefs || typeName != "" && len(decoder.types) == types
+      encoder.refId++
+      if t.Len < 0 {
+        encoder.writeVariableListHeader(typeName)
+      } else {
+        encoder.writeListHeader(typeName, t.Len)
+      }
+      ends = append(ends, t.Len < 0 || encoder.v1)
+    case MapStart:
+      use.typeRefs = use.typeRefs || t.Type != "" && len(decoder.types) == types
+      encoder.refId++
+      encoder.writeMapHeader(t.Type)
+      ends = append(ends, true)
+    case ObjectStart:
+      use.objects = true
+      encoder.refId++
+      encoder.writeObjectHeader(t.Class, t.Fields)
+      ends = append(ends, false)
+    case Ref:
+      use.refs = true
+      if t.ID < refBase || t.ID >= decoder.refId {
+        return use, &ReferenceError{offset, "ref", t.ID}
+      }
+      encoder.WriteRef(t.ID - refBase + encoderBase)
+    case End:
+      if ends[len(ends) - 1] {
+        encoder.write(end)
+      }
+      ends = ends[:len(ends) - 1]
+    default:
+      if err := encoder.WriteValue(t); err != nil {
+        return use, err
+      }
+    }
+    if len(decoder.tokens) == level {
+      return use, nil
+    }
+  }
+}
@@ -0,0 +1,173 @@
+package hessian
+
+import (
+  "bytes"
+  "testing"
+)
+
+func TestReadRaw(t *testing.T) {
+  inner := Object{"com.acme.Part", []string{"sku"}, []interface{}{"x-1"}}
+  encoder := NewEncoder()
+  encoder.WriteList(List{UNTYPED, []interface{}{
+    "route",
+    List{"[int", []interface{}{int32(1), int32(2)}},
+    inner,
+  }})
+  code := encoder.Bytes()
+  decoder := NewDecoder(code)
+  _, err := decoder.Token()
+  unexpected_error(err, t)
+  unexpected_error(decoder.Skip(), t)
+  start := decoder.Offset()
+  list, err := decoder.ReadRaw()
+  unexpected_error(err, t)
+  object, err := decoder.ReadRaw()
+  unexpected_error(err, t)
+  if !bytes.Equal(list, code[start:start + int64(len(list))]) || !bytes.Equal(object, code[int(start) + len(list):]) {
+    t.Errorf("readRaw: expect the bytes of the values found %x %x", list, object)
+  }
+
+  // spliced back, the encoder numbers its refs and class definitions after the raw values
+  shared := &List{UNTYPED, []interface{}{"a"}}
+  encoder = NewEncoder()
+  encoder.WriteValue(&List{UNTYPED, []interface{}{list, object, inner, shared, shared}})
+  v, err := NewDecoder(encoder.Bytes()).ReadValue()
+  unexpected_error(err, t)
+  values := v.(*List).Value
+  if len(values) != 5 || values[2].(*Object).ValueType != "com.acme.Part" || values[3] != values[4] {
+    t.Errorf("writeRaw: splice error, found %v", values)
+  }
+  if item, _ := values[1].(*Object).Get("sku"); item != "x-1" {
+    t.Errorf("writeRaw: raw object decode error, found %v", values[1])
+  }
+
+  // a class definition ref to outside the raw value
+  if err := NewEncoder().WriteRaw(RawMessage{0x60, 0x01, 0x61}); err == nil {
+    t.Errorf("writeRaw: expect error for an unknown class definition")
+  }
+  if err := NewEncoder().WriteRaw(RawMessage{0x91, 0x92}); err == nil {
+    t.Errorf("writeRaw: expect error for trailing data")
+  }
+}
+
+func TestUnmarshalRaw(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteTypedMap(TypedMap{"com.acme.Envelope", map[string]interface{}{
+    "route": "orders",
+    "body": TypedMap{"com.acme.Payload", map[string]interface{}{"id": int32(7)}},
+  }})
+  var raw RawMessage
+  err := Unmarshal(encoder.Bytes(), &raw)
+  unexpected_error(err, t)
+  if !bytes.Equal(raw, encoder.Bytes()) {
+    t.Errorf("unmarshal: expect raw bytes %x found %x", encoder.Bytes(), raw)
+  }
+  var envelope struct {
+    Route string `hessian:"route"`
+    Body RawMessage `hessian:"body"`
+  }
+  err = Unmarshal(encoder.Bytes(), &envelope)
+  unexpected_error(err, t)
+  body, err := NewDecoder(envelope.Body).ReadTypedMap()
+  unexpected_error(err, t)
+  if envelope.Route != "orders" || body.ValueType != "com.acme.Payload" || body.Value["id"] != int32(7) {
+    t.Errorf("unmarshal: raw field error, found %+v %+v", envelope, body)
+  }
+  // and written back as it is
+  code, err := Marshal(envelope)
+  unexpected_error(err, t)
+  if !bytes.Contains(code, envelope.Body) {
+    t.Errorf("marshal: raw field not written as it is, found %x", code)
+  }
+}
+
+func TestReadRawRepeated(t *testing.T) {
+  order := Object{"com.acme.Invoice", []string{"id"}, []interface{}{int32(1)}}
+  other := Object{"com.acme.Invoice", []string{"id"}, []interface{}{int32(2)}}
+  ints := List{"[com.acme.Line", []interface{}{int32(1)}}
+  shared := &List{UNTYPED, []interface{}{"a"}}
+  encoder := NewEncoder()
+  encoder.WriteList(List{UNTYPED, []interface{}{order, ints, other, ints, shared}})
+  loop := &List{UNTYPED, nil}
+  loop.Value = []interface{}{loop}
+  encoder.WriteList(List{UNTYPED, []interface{}{shared, loop}})
+  decoder := NewDecoder(encoder.Bytes())
+  _, err := decoder.Token()
+  unexpected_error(err, t)
+  var raws []RawMessage
+  for i := 0; i < 5; i++ {
+    raw, err := decoder.ReadRaw()
+    unexpected_error(err, t)
+    raws = append(raws, raw)
+  }
+  // the second order and list refer to definitions before them
+  for i, raw := range raws[:4] {
+    v, err := NewDecoder(raw).ReadValue()
+    unexpected_error(err, t)
+    if i % 2 == 0 {
+      if id, _ := v.(*Object).Get("id"); id != int32(i / 2 + 1) || v.(*Object).ValueType != "com.acme.Invoice" {
+        t.Errorf("readRaw: object %d decode error, found %x", i, raw)
+      }
+    } else if v.(*List).ValueType != "[com.acme.Line" {
+      t.Errorf("readRaw: list %d decode error, found %x", i, raw)
+    }
+  }
+  _, err = decoder.Token()
+  unexpected_error(err, t)
+  _, err = decoder.Token()
+  unexpected_error(err, t)
+  // a ref to a container outside the value
+  if _, err := decoder.ReadRaw(); err == nil {
+    t.Errorf("readRaw: expect error for a ref outside the value")
+  }
+  // refs inside the value are numbered from it
+  raw, err := decoder.ReadRaw()
+  unexpected_error(err, t)
+  if !bytes.Equal(raw, RawMessage{0x79, 0x51, 0x90}) {
+    t.Errorf("readRaw: expect refs numbered from the value found %x", raw)
+  }
+
+  // spliced after other definitions and containers, the encoder numbers them again
+  encoder = NewEncoder()
+  encoder.WriteValue(&List{UNTYPED, []interface{}{
+    Object{"com.acme.Part", []string{"sku"}, []interface{}{"x-1"}},
+    List{"[string", []interface{}{}},
+    raws[2], raws[3], raws[2], raw, order,
+  }})
+  v, err := NewDecoder(encoder.Bytes()).ReadValue()
+  unexpected_error(err, t)
+  values := v.(*List).Value
+  if id, _ := values[2].(*Object).Get("id"); id != int32(2) || values[2].(*Object).ValueType != "com.acme.Invoice" {
+    t.Errorf("writeRaw: object splice error, found %v", values[2])
+  }
+  if values[3].(*List).ValueType != "[com.acme.Line" || values[4].(*Object).ValueType != "com.acme.Invoice" {
+    t.Errorf("writeRaw: splice error, found %v", values)
+  }
+  if inner := values[5].(*List); inner.Value[0] != inner {
+    t.Errorf("writeRaw: ref splice error, found %v", inner.Value)
+  }
+  if values[6].(*Object).ValueType != "com.acme.Invoice" {
+    t.Errorf("writeRaw: expect definitions of raw values kept found %v", values[6])
+  }
+
+  // the second value of a typed list read by tokens
+  encoder = NewEncoder()
+  encoder.WriteList(List{"[com.acme.Invoice", []interface{}{order, other}})
+  decoder = NewDecoder(encoder.Bytes())
+  _, err = decoder.Token()
+  unexpected_error(err, t)
+  unexpected_error(decoder.Skip(), t)
+  raw, err = decoder.ReadRaw()
+  unexpected_error(err, t)
+  encoder = NewEncoder()
+  unexpected_error(encoder.WriteRaw(raws[0]), t)
+  unexpected_error(encoder.WriteRaw(raw), t)
+  decoder = NewDecoder(encoder.Bytes())
+  for i := 1; i <= 2; i++ {
+    v, err := decoder.ReadValue()
+    unexpected_error(err, t)
+    if id, _ := v.(*Object).Get("id"); id != int32(i) {
+      t.Errorf("writeRaw: expect invoice %d found %v", i, v)
+    }
+  }
+}
@@ -0,0 +1,133 @@
+package hessian
+
+import (
+  "fmt"
+  "reflect"
+  "strings"
+  "sync"
+)
+
+// java class names registered by RegisterType
+var registry = struct {
+  sync.RWMutex
+  types map[string]reflect.Type
+  names map[reflect.Type]string
+}{
+  types: make(map[string]reflect.Type),
+  names: make(map[reflect.Type]string),
+}
+
+// RegisterType makes ReadValue and Decode return typed maps and objects of the
+// java class name as pointers to the struct type of prototype, and typed lists
+// of the class as slices of those pointers. the encoder writes the struct type
+// with the class name unless it implements JavaClass. values of classes that
+// are not registered keep their generic type. it panics if prototype is not a
+// struct or a struct pointer, or if name is registered for another type
+func RegisterType(name string, prototype interface{}) {
+  t := reflect.TypeOf(prototype)
+  for t != nil && t.Kind() == reflect.Ptr {
+    t = t.Elem()
+  }
+  if t == nil || t.Kind() != reflect.Struct {
+    panic(fmt.Sprintf("hessian: register %s: %T is not a struct", name, prototype))
+  }
+  registry.Lock()
+  defer registry.Unlock()
+  if old, ok := registry.types[name]; ok && old != t {
+    panic(fmt.Sprintf("hessian: register %s: registered for %s and %s", name, old, t))
+  }
+  registry.types[name] = t
+  registry.names[t] = name
+}
+
+func registeredType(name string) (reflect.Type, bool) {
+  registry.RLock()
+  defer registry.RUnlock()
+  t, ok := registry.types[name]
+  return t, ok
+}
+
+func registeredName(t reflect.Type) (string, bool) {
+  registry.RLock()
+  defer registry.RUnlock()
+  name, ok := registry.names[t]
+  return name, ok
+}
+
+func hasRegisteredTypes() bool {
+  registry.RLock()
+  defer registry.RUnlock()
+  return len(registry.types) > 0
+}
+
+// resolve replaces the typed maps, objects and typed lists of registered
+// classes and deserializers in the value graph of src with go values. the graph is complete
+// when resolve is called, so refs and cycles resolve to the same pointer
+func (a *assigner) resolve(src interface{}) (interface{}, error) {
+  src, err := a.deserialize(src)
+  if err != nil || !hasRegisteredTypes() && !hasDeserializers() {
+    return src, err
+  }
+  switch value := src.(type) {
+  case *TypedMap:
+    if t, ok := registeredType(value.ValueType); ok {
+      return a.resolveTo(reflect.PtrTo(t), src)
+    }
+    if a.visit(value) {
+      for k, item := range value.Value {
+        if value.Value[k], err = a.resolve(item); err != nil {
+          return nil, err
+        }
+      }
+    }
+  case *Object:
+    if t, ok := registeredType(value.ValueType); ok {
+      return a.resolveTo(reflect.PtrTo(t), src)
+    }
+    if a.visit(value) {
+      for i, item := range value.Value {
+        if value.Value[i], err = a.resolve(item); err != nil {
+          return nil, err
+        }
+      }
+    }
+  case *List:
+    if t, ok := registeredType(strings.TrimPrefix(value.ValueType, "[")); ok {
+      return a.resolveTo(reflect.SliceOf(reflect.PtrTo(t)), src)
+    }
+    if a.visit(value) {
+      for i, item := range value.Value {
+        if value.Value[i], err = a.resolve(item); err != nil {
+          return nil, err
+        }
+      }
+    }
+  case map[interface{}]interface{}:
+    if a.visit(value) {
+      for k, item := range value {
+        if value[k], err = a.resolve(item); err != nil {
+          return nil, err
+        }
+      }
+    }
+  }
+  return src, nil
+}
+
+func (a *assigner) resolveTo(t reflect.Type, src interface{}) (interface{}, error) {
+  dst := reflect.New(t).Elem()
+  if err := a.assign(dst, src); err != nil {
+    return nil, err
+  }
+  return dst.Interface(), nil
+}
+
+// visit reports whether the generic container v is seen for the first time
+func (a *assigner) visit(v interface{}) bool {
+  ptr := reflect.ValueOf(v).Pointer()
+  if a.visited[ptr] {
+    return false
+  }
+  a.visited[ptr] = true
+  return true
+}
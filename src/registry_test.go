@@ -0,0 +1,148 @@
+package hessian
+
+import (
+  "reflect"
+  "testing"
+)
+
+type registryItem struct {
+  Sku string `hessian:"sku"`
+  Count int32 `hessian:"count"`
+}
+
+type registryOrder struct {
+  ID int64 `hessian:"id"`
+  Items []*registryItem `hessian:"items"`
+  Main registryItem `hessian:"main"`
+  Extra interface{} `hessian:"extra"`
+}
+
+type registryNode struct {
+  Name string
+  Next *registryNode
+}
+
+func init() {
+  RegisterType("com.acme.Order", registryOrder{})
+  RegisterType("com.acme.Item", &registryItem{})
+  RegisterType("com.acme.Node", registryNode{})
+}
+
+func TestRegisterTypeObject(t *testing.T) {
+  item := &registryItem{"a-1", 2}
+  order := &registryOrder{
+    ID: 7,
+    Items: []*registryItem{item, item},
+    Main: registryItem{"b-2", 1},
+    Extra: item,
+  }
+  v, err := NewDecoder(mustMarshal(t, order)).ReadValue()
+  unexpected_error(err, t)
+  ret, ok := v.(*registryOrder)
+  if !ok {
+    t.Fatalf("registerType: expect *registryOrder found %T", v)
+  }
+  if ret.ID != 7 || len(ret.Items) != 2 || *ret.Items[0] != *item || ret.Main != order.Main {
+    t.Errorf("registerType: decode error, found %+v", ret)
+  }
+  if ret.Items[0] != ret.Items[1] || ret.Extra != ret.Items[0] {
+    t.Errorf("registerType: refs not decoded to the same pointer")
+  }
+
+  // typed lists of a registered class are slices
+  v, err = NewDecoder(mustMarshal(t, []registryItem{*item})).ReadValue()
+  unexpected_error(err, t)
+  items, ok := v.([]*registryItem)
+  if !ok || len(items) != 1 || *items[0] != *item {
+    t.Errorf("registerType: expect []*registryItem found %#v", v)
+  }
+}
+
+func TestRegisterTypeFallback(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteObject(Object{
+    ValueType: "com.acme.Unknown",
+    Fields: []string{"item", "items"},
+    Value: []interface{}{
+      &registryItem{"a-1", 2},
+      map[interface{}]interface{}{"k": &registryItem{"b-2", 1}},
+    },
+  })
+  v, err := NewDecoder(encoder.Bytes()).ReadValue()
+  unexpected_error(err, t)
+  object, ok := v.(*Object)
+  if !ok || object.ValueType != "com.acme.Unknown" {
+    t.Fatalf("registerType: expect *Object found %T", v)
+  }
+  if item, ok := object.Value[0].(*registryItem); !ok || item.Sku != "a-1" {
+    t.Errorf("registerType: nested value not resolved, found %#v", object.Value[0])
+  }
+  nested := object.Value[1].(map[interface{}]interface{})
+  if item, ok := nested["k"].(*registryItem); !ok || item.Sku != "b-2" {
+    t.Errorf("registerType: map value not resolved, found %#v", nested["k"])
+  }
+
+  // a registered class with mismatched fields is an error
+  encoder = NewEncoder()
+  encoder.WriteTypedMap(TypedMap{ValueType: "com.acme.Item", Value: map[string]interface{}{"count": "x"}})
+  if _, err := NewDecoder(encoder.Bytes()).ReadValue(); err == nil {
+    t.Errorf("registerType: expect assign error")
+  }
+}
+
+func TestRegisterTypeCycle(t *testing.T) {
+  a := &registryNode{Name: "a"}
+  a.Next = &registryNode{Name: "b", Next: a}
+  var v interface{}
+  unexpected_error(Unmarshal(mustMarshal(t, a), &v), t)
+  ret, ok := v.(*registryNode)
+  if !ok || ret.Name != "a" || ret.Next.Name != "b" || ret.Next.Next != ret {
+    t.Errorf("registerType: cycle not decoded, found %#v", v)
+  }
+}
+
+func TestRegisterTypeDecodeOtherType(t *testing.T) {
+  type otherItem struct {
+    Sku string `hessian:"sku"`
+  }
+  code := mustMarshal(t, &registryItem{"a-1", 2})
+  // Decode assigns the unresolved value to the destination type
+  var m map[string]interface{}
+  unexpected_error(Unmarshal(code, &m), t)
+  if m["sku"] != "a-1" || m["count"] != int32(2) {
+    t.Errorf("registerType: decode into map found %v", m)
+  }
+  var other otherItem
+  unexpected_error(Unmarshal(code, &other), t)
+  if other.Sku != "a-1" {
+    t.Errorf("registerType: decode into other struct found %+v", other)
+  }
+  // resolved values, like the replies of Client.Invoke, are assigned as well
+  v, err := NewDecoder(code).ReadValue()
+  unexpected_error(err, t)
+  m = nil
+  unexpected_error(newAssigner().assign(reflect.ValueOf(&m).Elem(), v), t)
+  if m["sku"] != "a-1" || m["count"] != int32(2) {
+    t.Errorf("registerType: assign resolved value to map found %v", m)
+  }
+  other = otherItem{}
+  unexpected_error(newAssigner().assign(reflect.ValueOf(&other).Elem(), v), t)
+  if other.Sku != "a-1" {
+    t.Errorf("registerType: assign resolved value to other struct found %+v", other)
+  }
+}
+
+func TestRegisterTypePanics(t *testing.T) {
+  mustPanic := func(name string, prototype interface{}) {
+    defer func() {
+      if recover() == nil {
+        t.Errorf("registerType: expect panic for %s %T", name, prototype)
+      }
+    }()
+    RegisterType(name, prototype)
+  }
+  mustPanic("com.acme.Int", 1)
+  mustPanic("com.acme.Order", registryItem{})
+  // registering the same type again is allowed
+  RegisterType("com.acme.Order", &registryOrder{})
+}
@@ -0,0 +1,191 @@
+package hessian
+
+import (
+  "fmt"
+)
+
+// Fault is the error a hessian service replies with
+type Fault struct {
+  Code string // like "NoSuchMethodException" or "ServiceException"
+  Message string
+  Detail interface{}
+}
+
+func (fault *Fault) Error() string {
+  return fmt.Sprintf("hessian: fault %s: %s", fault.Code, fault.Message)
+}
+
+/**
+ * version ::= H x02 x00
+ * the version header is optional when reading
+ */
+func (decoder *Decoder) readVersion() error {
+  code, err := decoder.peek()
+  if err != nil {
+    return err
+  }
+  if code != 0x48 {
+    return nil
+  }
+  decoder.read()
+  bits, err := decoder.readn(2)
+  if err != nil {
+    return err
+  }
+  if bits[0] != 0x02 || bits[1] != 0x00 {
+    return decoder.syntaxError(decoder.offset - 2, bits[0], "version 2.0")
+  }
+  return nil
+}
+
+/**
+ * call ::= C string int value*
+ */
+func (decoder *Decoder) ReadCall() (string, []interface{}, error) {
+  method, args, err := decoder.readCall()
+  if err != nil {
+    return "", nil, err
+  }
+  if err := decoder.resolveValues(args); err != nil {
+    return "", nil, err
+  }
+  return method, args, nil
+}
+
+// readCall reads a call without resolving registered classes in the arguments
+func (decoder *Decoder) readCall() (string, []interface{}, error) {
+  if decoder.v1 {
+    return decoder.readCallV1()
+  }
+  if err := decoder.readVersion(); err != nil {
+    return "", nil, err
+  }
+  code, err := decoder.read()
+  if err != nil {
+    return "", nil, decoder.unexpectedEOF(err, "call")
+  }
+  if code != 0x43 {
+    return "", nil, decoder.syntaxError(decoder.offset - 1, code, "call")
+  }
+  method, err := decoder.ReadString()
+  if err != nil {
+    return "", nil, decoder.unexpectedEOF(err, "method")
+  }
+  size, err := decoder.ReadInt()
+  if err != nil {
+    return "", nil, decoder.unexpectedEOF(err, "argument count")
+  }
+  if size < 0 {
+    return "", nil, fmt.Errorf("hessian: negative argument count %d at offset %d: %w", size, decoder.offset, ErrSyntax)
+  }
+  args, err := decoder.readFixedLengthValue(int(size))
+  if err != nil {
+    return "", nil, decoder.unexpectedEOF(err, "argument")
+  }
+  return method, args, nil
+}
+
+/**
+ * reply ::= R value
+ *       ::= F map
+ * a fault is returned as *Fault error
+ */
+func (decoder *Decoder) ReadReply() (interface{}, error) {
+  v, err := decoder.readReply()
+  if err != nil {
+    return nil, err
+  }
+  return decoder.resolve(v)
+}
+
+// readReply reads a reply without resolving registered classes in the value
+func (decoder *Decoder) readReply() (interface{}, error) {
+  if decoder.v1 {
+    return decoder.readReplyV1()
+  }
+  if err := decoder.readVersion(); err != nil {
+    return nil, err
+  }
+  code, err := decoder.read()
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "reply")
+  }
+  switch code {
+  case 0x52:
+    ret, err := decoder.readValue()
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "reply value")
+    }
+    return ret, nil
+  case 0x46:
+    return nil, decoder.readFault()
+  }
+  return nil, decoder.syntaxError(decoder.offset - 1, code, "reply")
+}
+
+func (decoder *Decoder) readFault() error {
+  v, err := decoder.ReadValue()
+  if err != nil {
+    return decoder.unexpectedEOF(err, "fault")
+  }
+  fields := mapEntries(v)
+  if fields == nil {
+    return fmt.Errorf("hessian: fault is %T, map expected: %w", v, ErrSyntax)
+  }
+  return newFault(fields)
+}
+
+func newFault(fields map[interface{}]interface{}) *Fault {
+  fault := &Fault{Detail: fields["detail"]}
+  fault.Code, _ = fields["code"].(string)
+  fault.Message, _ = fields["message"].(string)
+  return fault
+}
+
+func (encoder *Encoder) writeVersion() {
+  encoder.write(0x48, 0x02, 0x00)
+}
+
+// WriteCall writes a call with its version header, arguments are written by Encode
+func (encoder *Encoder) WriteCall(method string, args ...interface{}) error {
+  if encoder.v1 {
+    return encoder.writeCallV1(method, args)
+  }
+  encoder.writeVersion()
+  encoder.write(0x43)
+  encoder.WriteString(method)
+  encoder.WriteInt(int32(len(args)))
+  for _, arg := range args {
+    if err := encoder.Encode(arg); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// WriteReply writes a reply with its version header, v is written by Encode
+func (encoder *Encoder) WriteReply(v interface{}) error {
+  if encoder.v1 {
+    return encoder.writeReplyV1(v)
+  }
+  encoder.writeVersion()
+  encoder.write(0x52)
+  return encoder.Encode(v)
+}
+
+// WriteFault writes a fault reply with its version header
+func (encoder *Encoder) WriteFault(fault *Fault) error {
+  fields := map[interface{}]interface{}{
+    "code": fault.Code,
+    "message": fault.Message,
+  }
+  if fault.Detail != nil {
+    fields["detail"] = fault.Detail
+  }
+  if encoder.v1 {
+    return encoder.writeFaultV1(fields)
+  }
+  encoder.writeVersion()
+  encoder.write(0x46)
+  return encoder.Encode(fields)
+}
@@ -0,0 +1,63 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "testing"
+)
+
+func TestReadCall(t *testing.T) {
+  // add2(2, 3) as sent by java
+  code := []byte{0x48, 0x02, 0x00, 0x43, 0x04, 0x61, 0x64, 0x64, 0x32, 0x92, 0x92, 0x93}
+  method, args, err := NewDecoder(code).ReadCall()
+  unexpected_error(err, t)
+  if method != "add2" || len(args) != 2 || args[0] != int32(2) || args[1] != int32(3) {
+    t.Errorf("readCall: decode error, found %s %v", method, args)
+  }
+  encoder := NewEncoder()
+  encoder.WriteCall("add2", int32(2), int32(3))
+  if !bytes.Equal(encoder.Bytes(), code) {
+    t.Errorf("writeCall: expect %x found %x", code, encoder.Bytes())
+  }
+  {
+    // without version header
+    method, args, err := NewDecoder(code[3:]).ReadCall()
+    unexpected_error(err, t)
+    if method != "add2" || len(args) != 2 {
+      t.Errorf("readCall: decode error")
+    }
+  }
+  {
+    _, _, err := NewDecoder([]byte{0x48, 0x01, 0x00, 0x43}).ReadCall()
+    if !errors.Is(err, ErrSyntax) {
+      t.Errorf("readCall: expect syntax error found %v", err)
+    }
+  }
+}
+
+func TestReadReply(t *testing.T) {
+  code := []byte{0x48, 0x02, 0x00, 0x52, 0x95}
+  v, err := NewDecoder(code).ReadReply()
+  unexpected_error(err, t)
+  if v != int32(5) {
+    t.Errorf("readReply: expect 5 found %v", v)
+  }
+  encoder := NewEncoder()
+  encoder.WriteReply(int32(5))
+  if !bytes.Equal(encoder.Bytes(), code) {
+    t.Errorf("writeReply: expect %x found %x", code, encoder.Bytes())
+  }
+}
+
+func TestReadFault(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteFault(&Fault{"ServiceException", "File Not Found", "detail"})
+  _, err := NewDecoder(encoder.Bytes()).ReadReply()
+  var fault *Fault
+  if !errors.As(err, &fault) {
+    t.Fatalf("readReply: expect fault found %v", err)
+  }
+  if fault.Code != "ServiceException" || fault.Message != "File Not Found" || fault.Detail != "detail" {
+    t.Errorf("readReply: fault decode error, found %+v", fault)
+  }
+}
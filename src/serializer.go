@@ -0,0 +1,155 @@
+package hessian
+
+import (
+  "fmt"
+  "reflect"
+  "sync"
+)
+
+// Serializer writes go values of a java class that has a custom hessian
+// serializer, like java.math.BigDecimal written as an object with a single
+// value field
+type Serializer interface {
+  // Serialize returns the value written instead of v, usually an Object
+  Serialize(v interface{}) (interface{}, error)
+}
+
+// Deserializer reads the values of a java class that has a custom hessian
+// serializer
+type Deserializer interface {
+  // Deserialize returns the go value of a decoded *Object, *TypedMap or *List
+  // of the class, the values it holds are not deserialized yet
+  Deserialize(v interface{}) (interface{}, error)
+}
+
+// SerializerFunc adapts a function to Serializer
+type SerializerFunc func(v interface{}) (interface{}, error)
+
+func (f SerializerFunc) Serialize(v interface{}) (interface{}, error) {
+  return f(v)
+}
+
+// DeserializerFunc adapts a function to Deserializer
+type DeserializerFunc func(v interface{}) (interface{}, error)
+
+func (f DeserializerFunc) Deserialize(v interface{}) (interface{}, error) {
+  return f(v)
+}
+
+// custom serializers by java class name
+var serializers = struct {
+  sync.RWMutex
+  serializers map[string]Serializer
+  names map[reflect.Type]string
+  deserializers map[string]Deserializer
+}{
+  serializers: make(map[string]Serializer),
+  names: make(map[reflect.Type]string),
+  deserializers: make(map[string]Deserializer),
+}
+
+// RegisterSerializer makes the encoder write go values of the java class
+// name with s. the values are those of the type of prototype, which may be nil,
+// and those whose JavaClassName or registered type name is name
+func RegisterSerializer(name string, prototype interface{}, s Serializer) {
+  serializers.Lock()
+  defer serializers.Unlock()
+  serializers.serializers[name] = s
+  if prototype != nil {
+    serializers.names[reflect.TypeOf(prototype)] = name
+  }
+}
+
+// RegisterDeserializer makes ReadValue and Decode return what d returns for the
+// typed maps, objects and typed lists of the java class name. it takes
+// precedence over RegisterType
+func RegisterDeserializer(name string, d Deserializer) {
+  serializers.Lock()
+  defer serializers.Unlock()
+  serializers.deserializers[name] = d
+}
+
+// serializerOf returns the serializer registered for the class of v,
+// v is not a pointer
+func serializerOf(v reflect.Value) (Serializer, bool) {
+  serializers.RLock()
+  defer serializers.RUnlock()
+  if len(serializers.serializers) == 0 {
+    return nil, false
+  }
+  name, ok := serializers.names[v.Type()]
+  if !ok {
+    if v.Kind() != reflect.Struct && !v.Type().Implements(javaClassType) {
+      return nil, false
+    }
+    name = javaClassName(v)
+  }
+  s, ok := serializers.serializers[name]
+  return s, ok
+}
+
+func hasDeserializers() bool {
+  serializers.RLock()
+  defer serializers.RUnlock()
+  return len(serializers.deserializers) > 0
+}
+
+func deserializerOf(className string) (Deserializer, bool) {
+  serializers.RLock()
+  defer serializers.RUnlock()
+  d, ok := serializers.deserializers[className]
+  return d, ok
+}
+
+// encodeCustom writes v with its registered serializer, it reports false
+// when there is none. pointers are given to the serializer dereferenced
+func (encoder *Encoder) encodeCustom(v reflect.Value) (bool, error) {
+  for v.Kind() == reflect.Ptr && !v.IsNil() {
+    v = v.Elem()
+  }
+  if !v.CanInterface() || v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr {
+    return false, nil
+  }
+  s, ok := serializerOf(v)
+  if !ok {
+    return false, nil
+  }
+  ret, err := s.Serialize(v.Interface())
+  if err != nil {
+    return true, err
+  }
+  if ret != nil && reflect.TypeOf(ret) == v.Type() {
+    return true, fmt.Errorf("encode error: serializer of %s returned the same type", v.Type())
+  }
+  return true, encoder.WriteValue(ret)
+}
+
+// deserialize returns what the registered deserializer returns for src,
+// src itself when it is not a value of a class with a deserializer
+func (a *assigner) deserialize(src interface{}) (interface{}, error) {
+  var className string
+  switch value := src.(type) {
+  case *Object:
+    className = value.ValueType
+  case *TypedMap:
+    className = value.ValueType
+  case *List:
+    className = value.ValueType
+  default:
+    return src, nil
+  }
+  d, ok := deserializerOf(className)
+  if !ok {
+    return src, nil
+  }
+  ptr := reflect.ValueOf(src).Pointer()
+  if ret, ok := a.custom[ptr]; ok {
+    return ret, nil
+  }
+  ret, err := d.Deserialize(src)
+  if err != nil {
+    return nil, fmt.Errorf("decode error: %s: %w", className, err)
+  }
+  a.custom[ptr] = ret
+  return ret, nil
+}
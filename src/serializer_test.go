@@ -0,0 +1,93 @@
+package hessian
+
+import (
+  "errors"
+  "fmt"
+  "testing"
+)
+
+type serializerMoney struct {
+  Cents int64
+}
+
+type serializerCode string
+
+func (serializerCode) JavaClassName() string {
+  return "com.acme.Code"
+}
+
+func init() {
+  RegisterSerializer("com.acme.Money", serializerMoney{}, SerializerFunc(func(v interface{}) (interface{}, error) {
+    cents := v.(serializerMoney).Cents
+    return Object{
+      ValueType: "com.acme.Money",
+      Fields: []string{"amount"},
+      Value: []interface{}{fmt.Sprintf("%d.%02d", cents / 100, cents % 100)},
+    }, nil
+  }))
+  RegisterDeserializer("com.acme.Money", DeserializerFunc(func(v interface{}) (interface{}, error) {
+    amount, _ := v.(*Object).Get("amount")
+    var units, cents int64
+    if _, err := fmt.Sscanf(fmt.Sprint(amount), "%d.%02d", &units, &cents); err != nil {
+      return nil, err
+    }
+    return serializerMoney{units * 100 + cents}, nil
+  }))
+  // found by JavaClassName, no prototype
+  RegisterSerializer("com.acme.Code", nil, SerializerFunc(func(v interface{}) (interface{}, error) {
+    return TypedMap{ValueType: "com.acme.Code", Value: map[string]interface{}{"value": string(v.(serializerCode))}}, nil
+  }))
+  RegisterDeserializer("com.acme.Code", DeserializerFunc(func(v interface{}) (interface{}, error) {
+    return serializerCode(v.(*TypedMap).Value["value"].(string)), nil
+  }))
+}
+
+type serializerInvoice struct {
+  Total serializerMoney `hessian:"total"`
+  Code serializerCode `hessian:"code"`
+  Lines []interface{} `hessian:"lines"`
+}
+
+func TestSerializer(t *testing.T) {
+  code := mustMarshal(t, serializerMoney{1234})
+  object, err := NewDecoder(code).ReadObject()
+  unexpected_error(err, t)
+  if amount, _ := object.Get("amount"); object.ValueType != "com.acme.Money" || amount != "12.34" {
+    t.Errorf("serializer: encode error, found %v", object)
+  }
+  v, err := NewDecoder(code).ReadValue()
+  unexpected_error(err, t)
+  if v != (serializerMoney{1234}) {
+    t.Errorf("deserializer: expect 1234 cents found %v", v)
+  }
+
+  invoice := serializerInvoice{
+    Total: serializerMoney{500},
+    Code: "A1",
+    Lines: []interface{}{serializerMoney{200}, &serializerMoney{300}},
+  }
+  var ret serializerInvoice
+  unexpected_error(Unmarshal(mustMarshal(t, invoice), &ret), t)
+  if ret.Total != invoice.Total || ret.Code != "A1" || len(ret.Lines) != 2 ||
+    ret.Lines[0] != (serializerMoney{200}) || ret.Lines[1] != (serializerMoney{300}) {
+    t.Errorf("deserializer: decode error, found %+v", ret)
+  }
+
+  // WriteValue goes through the serializer for nested go values
+  encoder := NewEncoder()
+  encoder.WriteValue(map[interface{}]interface{}{"a": serializerCode("x")})
+  v, err = NewDecoder(encoder.Bytes()).ReadValue()
+  unexpected_error(err, t)
+  if m := v.(map[interface{}]interface{}); m["a"] != serializerCode("x") {
+    t.Errorf("deserializer: nested value not deserialized, found %v", m)
+  }
+}
+
+func TestDeserializerError(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteObject(Object{ValueType: "com.acme.Money", Fields: []string{"amount"}, Value: []interface{}{"x"}})
+  _, err := NewDecoder(encoder.Bytes()).ReadValue()
+  if err == nil || errors.Is(err, ErrSyntax) {
+    t.Errorf("deserializer: expect deserializer error found %v", err)
+  }
+}
@@ -0,0 +1,163 @@
+package hessian
+
+import (
+  "bufio"
+  "errors"
+  "fmt"
+  "net/http"
+  "reflect"
+  "strconv"
+  "strings"
+  "sync"
+)
+
+// Server is an http.Handler calling registered go functions for hessian calls,
+// so java HessianProxyFactory clients can call go services
+type Server struct {
+  // Options bounds the calls read, it is set before serving
+  Options DecoderOptions
+  mu sync.RWMutex
+  methods map[string]map[int]reflect.Value // name to functions by argument count
+}
+
+func NewServer() *Server {
+  return &Server{methods: make(map[string]map[int]reflect.Value)}
+}
+
+// Register registers fn for calls to method. fn may return nothing, a value,
+// an error or a value and an error. a method may be registered once per
+// argument count, like an overloaded java method
+func (server *Server) Register(method string, fn interface{}) error {
+  fv := reflect.ValueOf(fn)
+  if fv.Kind() != reflect.Func || fv.IsNil() {
+    return fmt.Errorf("hessian: register %s: %T is not a func", method, fn)
+  }
+  ft := fv.Type()
+  if ft.IsVariadic() {
+    return fmt.Errorf("hessian: register %s: variadic funcs are not supported", method)
+  }
+  switch ft.NumOut() {
+  case 0, 1:
+  case 2:
+    if ft.Out(1) != errorType {
+      return fmt.Errorf("hessian: register %s: second result must be error", method)
+    }
+  default:
+    return fmt.Errorf("hessian: register %s: too many results", method)
+  }
+  server.mu.Lock()
+  defer server.mu.Unlock()
+  if server.methods[method] == nil {
+    server.methods[method] = make(map[int]reflect.Value)
+  }
+  if _, ok := server.methods[method][ft.NumIn()]; ok {
+    return fmt.Errorf("hessian: register %s: %d arguments registered twice", method, ft.NumIn())
+  }
+  server.methods[method][ft.NumIn()] = fv
+  return nil
+}
+
+// RegisterService registers the exported methods of service,
+// named with their first letter lowered
+func (server *Server) RegisterService(service interface{}) error {
+  rv := reflect.ValueOf(service)
+  for i := 0; i < rv.NumMethod(); i++ {
+    if err := server.Register(lowerFirst(rv.Type().Method(i).Name), rv.Method(i).Interface()); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// lookup finds the function for a call, overloaded java methods
+// are called as method__N with N the argument count
+func (server *Server) lookup(method string, argc int) (reflect.Value, bool) {
+  server.mu.RLock()
+  defer server.mu.RUnlock()
+  if fns, ok := server.methods[method]; ok {
+    fn, ok := fns[argc]
+    return fn, ok
+  }
+  if i := strings.LastIndex(method, "__"); i > 0 {
+    if n, err := strconv.Atoi(method[i + 2:]); err == nil && n == argc {
+      fn, ok := server.methods[method[:i]][argc]
+      return fn, ok
+    }
+  }
+  return reflect.Value{}, false
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+  if r.Method != http.MethodPost {
+    w.Header().Set("Allow", http.MethodPost)
+    http.Error(w, "hessian requires POST", http.StatusMethodNotAllowed)
+    return
+  }
+  // java HessianProxyFactory sends 1.0 calls unless hessian2Request is set,
+  // the reply is written in the version of the call
+  body := bufio.NewReader(r.Body)
+  decoder := NewDecoderReader(body)
+  if code, err := body.Peek(1); err == nil && code[0] == 0x63 {
+    decoder = NewDecoderV1Reader(body)
+  }
+  decoder.SetOptions(server.Options)
+  encoder := newReplyEncoder(decoder)
+  // the arguments are assigned like Decode does, not resolved by ReadValue
+  method, args, err := decoder.readCall()
+  if err != nil {
+    encoder.WriteFault(&Fault{Code: "ProtocolException", Message: err.Error()})
+  } else if err := server.call(encoder, method, args); err != nil {
+    var fault *Fault
+    if !errors.As(err, &fault) {
+      fault = &Fault{Code: "ServiceException", Message: err.Error()}
+    }
+    encoder = newReplyEncoder(decoder)
+    if err := encoder.WriteFault(fault); err != nil {
+      http.Error(w, err.Error(), http.StatusInternalServerError)
+      return
+    }
+  }
+  w.Header().Set("Content-Type", ContentType)
+  w.Write(encoder.Bytes())
+}
+
+// newReplyEncoder returns an encoder for replies to the calls read by decoder
+func newReplyEncoder(decoder *Decoder) *Encoder {
+  if decoder.v1 {
+    return NewEncoderV1()
+  }
+  return NewEncoder()
+}
+
+// call writes the reply of method, errors are written as fault by ServeHTTP
+func (server *Server) call(encoder *Encoder, method string, args []interface{}) (err error) {
+  fn, ok := server.lookup(method, len(args))
+  if !ok {
+    return &Fault{Code: "NoSuchMethodException", Message: fmt.Sprintf("%s with %d arguments", method, len(args))}
+  }
+  ft := fn.Type()
+  in := make([]reflect.Value, len(args))
+  a := newAssigner()
+  for i, arg := range args {
+    in[i] = reflect.New(ft.In(i)).Elem()
+    if err := a.assign(in[i], arg); err != nil {
+      return &Fault{Code: "IllegalArgumentException", Message: err.Error()}
+    }
+  }
+  defer func() {
+    if r := recover(); r != nil {
+      err = fmt.Errorf("%s: %v", method, r)
+    }
+  }()
+  out := fn.Call(in)
+  if ft.NumOut() > 0 && ft.Out(ft.NumOut() - 1) == errorType {
+    if err, _ := out[len(out) - 1].Interface().(error); err != nil {
+      return err
+    }
+    out = out[:len(out) - 1]
+  }
+  if len(out) == 0 {
+    return encoder.WriteReply(nil)
+  }
+  return encoder.WriteReply(out[0].Interface())
+}
@@ -0,0 +1,227 @@
+package hessian
+
+import (
+  "bytes"
+  "errors"
+  "io"
+  "net/http"
+  "net/http/httptest"
+  "strings"
+  "testing"
+)
+
+type serverGreeter struct{}
+
+func (serverGreeter) Hello(name string) string {
+  return "hello " + name
+}
+
+func (serverGreeter) Fail() error {
+  return errors.New("failed")
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+  server := NewServer()
+  unexpected_error(server.RegisterService(serverGreeter{}), t)
+  unexpected_error(server.Register("add", func(a, b int32) int32 { return a + b }), t)
+  unexpected_error(server.Register("add", func(a, b, c int64) (int64, error) { return a + b + c, nil }), t)
+  unexpected_error(server.Register("panic", func() { panic("boom") }), t)
+  return httptest.NewServer(server)
+}
+
+func TestServerCall(t *testing.T) {
+  ts := newTestServer(t)
+  defer ts.Close()
+  client := NewClient(ts.URL, ts.Client())
+  v, err := client.Call("hello", "go")
+  unexpected_error(err, t)
+  if v != "hello go" {
+    t.Errorf("server: expect hello go found %v", v)
+  }
+  v, err = client.Call("add", int32(2), int32(3))
+  unexpected_error(err, t)
+  if v != int32(5) {
+    t.Errorf("server: expect 5 found %v", v)
+  }
+  // overloaded java methods are mangled with the argument count
+  v, err = client.Call("add__3", int32(1), int32(2), int32(3))
+  unexpected_error(err, t)
+  if v != int64(6) {
+    t.Errorf("server: expect 6 found %v", v)
+  }
+  v, err = client.Call("panic")
+  var fault *Fault
+  if !errors.As(err, &fault) || fault.Code != "ServiceException" {
+    t.Errorf("server: expect fault found %v %v", v, err)
+  }
+  tests := []struct {
+    method string
+    args []interface{}
+    code string
+  }{
+    {"fail", nil, "ServiceException"},
+    {"missing", nil, "NoSuchMethodException"},
+    {"add", []interface{}{int32(1)}, "NoSuchMethodException"},
+    {"add__3", []interface{}{int32(1), int32(2)}, "NoSuchMethodException"},
+    {"hello", []interface{}{int32(1)}, "IllegalArgumentException"},
+  }
+  for _, test := range tests {
+    _, err := client.Call(test.method, test.args...)
+    if !errors.As(err, &fault) || fault.Code != test.code {
+      t.Errorf("server: %s expect %s found %v", test.method, test.code, err)
+    }
+  }
+}
+
+func TestServerJavaCall(t *testing.T) {
+  ts := newTestServer(t)
+  defer ts.Close()
+  // add__2(2, 3) as sent by a java proxy with overloading enabled
+  code := []byte{0x48, 0x02, 0x00, 0x43, 0x06, 0x61, 0x64, 0x64, 0x5f, 0x5f, 0x32, 0x92, 0x92, 0x93}
+  resp, err := http.Post(ts.URL, ContentType, bytes.NewReader(code))
+  unexpected_error(err, t)
+  defer resp.Body.Close()
+  body, err := io.ReadAll(resp.Body)
+  unexpected_error(err, t)
+  expect := []byte{0x48, 0x02, 0x00, 0x52, 0x95}
+  if !bytes.Equal(body, expect) {
+    t.Errorf("server: expect %x found %x", expect, body)
+  }
+  resp, err = http.Get(ts.URL)
+  unexpected_error(err, t)
+  resp.Body.Close()
+  if resp.StatusCode != http.StatusMethodNotAllowed {
+    t.Errorf("server: expect 405 found %d", resp.StatusCode)
+  }
+}
+
+func TestServerJavaV1Call(t *testing.T) {
+  ts := newTestServer(t)
+  defer ts.Close()
+  // hello("go") as sent by a java proxy without hessian2Request
+  code := append([]byte{0x63, 0x01, 0x00}, v1Chunk(0x6d, "hello")...)
+  code = append(code, v1Chunk(0x53, "go")...)
+  code = append(code, 0x7a)
+  resp, err := http.Post(ts.URL, ContentType, bytes.NewReader(code))
+  unexpected_error(err, t)
+  defer resp.Body.Close()
+  body, err := io.ReadAll(resp.Body)
+  unexpected_error(err, t)
+  expect := append([]byte{0x72, 0x01, 0x00}, v1Chunk(0x53, "hello go")...)
+  expect = append(expect, 0x7a)
+  if !bytes.Equal(body, expect) {
+    t.Errorf("server: expect %x found %x", expect, body)
+  }
+  // faults are replied in 1.0 as well
+  code = append([]byte{0x63, 0x01, 0x00}, v1Chunk(0x6d, "fail")...)
+  code = append(code, 0x7a)
+  resp, err = http.Post(ts.URL, ContentType, bytes.NewReader(code))
+  unexpected_error(err, t)
+  defer resp.Body.Close()
+  _, err = NewDecoderV1Reader(resp.Body).ReadReply()
+  var fault *Fault
+  if !errors.As(err, &fault) || fault.Code != "ServiceException" || fault.Message != "failed" {
+    t.Errorf("server: expect 1.0 fault found %v", err)
+  }
+}
+
+func TestServerOptions(t *testing.T) {
+  server := NewServer()
+  unexpected_error(server.RegisterService(serverGreeter{}), t)
+  ts := httptest.NewServer(server)
+  defer ts.Close()
+  // hello with lists nested past the stack, bounded by the default depth
+  code := []byte{0x48, 0x02, 0x00, 0x43, 0x05, 0x68, 0x65, 0x6c, 0x6c, 0x6f, 0x91}
+  code = append(code, bytes.Repeat([]byte{0x79}, 3 << 20)...)
+  resp, err := ts.Client().Post(ts.URL, ContentType, bytes.NewReader(code))
+  unexpected_error(err, t)
+  defer resp.Body.Close()
+  _, err = NewDecoderReader(resp.Body).ReadReply()
+  var fault *Fault
+  if !errors.As(err, &fault) || fault.Code != "ProtocolException" || !strings.Contains(fault.Message, ErrMaxDepth.Error()) {
+    t.Errorf("server: expect depth fault found %v", err)
+  }
+  server.Options = DecoderOptions{MaxStringLen: 1}
+  _, err = NewClient(ts.URL, ts.Client()).Call("hello", "go")
+  if !errors.As(err, &fault) || fault.Code != "ProtocolException" {
+    t.Errorf("server: expect options fault found %v", err)
+  }
+}
+
+func TestServerClassPolicy(t *testing.T) {
+  gadget := Object{"com.sun.rowset.JdbcRowSetImpl", []string{"dataSourceName"}, []interface{}{"ldap://example.com/a"}}
+  server := NewServer()
+  unexpected_error(server.RegisterService(serverGreeter{}), t)
+  unexpected_error(server.Register("echo", func(v interface{}) interface{} { return v }), t)
+  server.Options = DecoderOptions{Classes: ClassPolicy{Deny: []string{"com.sun.*"}}}
+  ts := httptest.NewServer(server)
+  defer ts.Close()
+  client := NewClient(ts.URL, ts.Client())
+  _, err := client.Call("echo", gadget)
+  var fault *Fault
+  if !errors.As(err, &fault) || fault.Code != "ProtocolException" || !strings.Contains(fault.Message, gadget.ValueType) {
+    t.Errorf("server: expect policy fault found %v", err)
+  }
+  v, err := client.Call("hello", "go")
+  unexpected_error(err, t)
+  if v != "hello go" {
+    t.Errorf("server: expect hello go found %v", v)
+  }
+
+  // replies are checked by the policy of the client
+  server.Options = DecoderOptions{}
+  client.Options = DecoderOptions{Classes: ClassPolicy{Allow: []string{"com.acme.*"}}}
+  if _, err := client.Call("echo", gadget); !errors.Is(err, ErrPolicy) {
+    t.Errorf("client: expect %v found %v", ErrPolicy, err)
+  }
+}
+
+func TestServerEnum(t *testing.T) {
+  // a class with a single name field, decoded into a struct and not as an enum
+  type tag struct {
+    Name string `hessian:"name"`
+  }
+  object := Object{"com.acme.Tag", []string{"name"}, []interface{}{"go"}}
+  server := NewServer()
+  unexpected_error(server.Register("tagName", func(t tag) string { return t.Name }), t)
+  unexpected_error(server.Register("color", func() Object { return object }), t)
+  ts := httptest.NewServer(server)
+  defer ts.Close()
+  client := NewClient(ts.URL, ts.Client())
+  v, err := client.Call("tagName", object)
+  unexpected_error(err, t)
+  if v != "go" {
+    t.Errorf("server: expect go found %v", v)
+  }
+  var s tag
+  unexpected_error(client.Invoke("color", &s), t)
+  var name string
+  unexpected_error(client.Invoke("color", &name), t)
+  var i interface{}
+  unexpected_error(client.Invoke("color", &i), t)
+  v, err = client.Call("color")
+  unexpected_error(err, t)
+  if s.Name != "go" || name != "go" || i != "go" {
+    t.Errorf("client: enum invoke error, found %+v %q %v", s, name, i)
+  }
+  if object, ok := v.(*Object); !ok || object.ValueType != "com.acme.Tag" {
+    t.Errorf("client: expect the object kept by call found %v", v)
+  }
+}
+
+func TestServerRegister(t *testing.T) {
+  server := NewServer()
+  if server.Register("x", 1) == nil {
+    t.Errorf("register: expect error for non func")
+  }
+  if server.Register("x", func() (int, int) { return 0, 0 }) == nil {
+    t.Errorf("register: expect error for second result")
+  }
+  if server.Register("x", func(...int) {}) == nil {
+    t.Errorf("register: expect error for variadic func")
+  }
+  unexpected_error(server.Register("x", func() {}), t)
+  if server.Register("x", func() {}) == nil {
+    t.Errorf("register: expect error for duplicate")
+  }
+}
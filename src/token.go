@@ -0,0 +1,227 @@
+package hessian
+
+import (
+  "errors"
+)
+
+// Token is what Decoder.Token returns: ListStart, MapStart, ObjectStart, End,
+// Ref, or a scalar value of type nil, bool, int32, int64, float64, string,
+// []byte or time.Time
+type Token interface{}
+
+// ListStart starts the values of a list, Len is -1 when the length is not
+// written ahead and the list ends at its End only
+type ListStart struct {
+  Type string
+  Len int
+}
+
+// MapStart starts the keys and values of a map, Type is empty for untyped maps
+type MapStart struct {
+  Type string
+}
+
+// ObjectStart starts the values of the fields of an object
+type ObjectStart struct {
+  Class string
+  Fields []string
+}
+
+// End ends the list, map or object started last
+type End struct{}
+
+// Ref refers to the list, map or object numbered ID, containers are numbered
+// in the order they start
+type Ref struct {
+  ID int32
+}
+
+// a list, map or object opened by Token
+type tokenFrame struct {
+  remaining int // values left in a fixed-length container, -1 until 'Z'
+}
+
+var errSkipEnd = errors.New("hessian: skip at the end of a container")
+
+// Token returns the next token of the input, and io.EOF at the end of the
+// input. the values of a container opened by Token are read with Token,
+// ReadValue or Skip, so that its End is found. containers are not kept, a ref
+// to a container read by tokens is returned as Ref but cannot be resolved by ReadValue
+func (decoder *Decoder) Token() (Token, error) {
+  if n := len(decoder.tokens); n > 0 {
+    end, err := decoder.atTokenEnd()
+    if err != nil {
+      return nil, err
+    }
+    if end {
+      if decoder.tokens[n - 1].remaining < 0 {
+        decoder.read()
+      }
+      decoder.tokens = decoder.tokens[:n - 1]
+      return End{}, nil
+    }
+  }
+  code, err := decoder.peek()
+  if err != nil {
+    if len(decoder.tokens) > 0 {
+      err = decoder.unexpectedEOF(err, "value")
+    }
+    return nil, err
+  }
+  codeToType := CODE_TO_TYPE
+  if decoder.v1 {
+    codeToType = CODE_TO_TYPE_V1
+  }
+  typeName, ok := codeToType[code]
+  if !ok {
+    decoder.read()
+    return nil, decoder.syntaxError(decoder.offset - 1, code, "value")
+  }
+  if err := decoder.checkDepth(len(decoder.tokens) + 1); err != nil {
+    return nil, err
+  }
+  decoder.countTokenValue()
+  switch typeName {
+  case "list":
+    l, size, err := decoder.readListHeader()
+    if err != nil {
+      return nil, err
+    }
+    if err := decoder.countRef(); err != nil {
+      return nil, err
+    }
+    decoder.tokens = append(decoder.tokens, tokenFrame{size})
+    return ListStart{l.ValueType, size}, nil
+  case "map", "typedmap":
+    return decoder.mapStart()
+  case "object":
+    return decoder.objectStart()
+  case "ref":
+    return decoder.refToken()
+  }
+  return dynamic_call(decoder, typeName)
+}
+
+// atTokenEnd reports whether the container opened last has no values left,
+// the 'Z' ending it is not read
+func (decoder *Decoder) atTokenEnd() (bool, error) {
+  frame := decoder.tokens[len(decoder.tokens) - 1]
+  if frame.remaining >= 0 {
+    return frame.remaining == 0, nil
+  }
+  end := byte(0x5a)
+  if decoder.v1 {
+    end = 0x7a
+  }
+  code, err := decoder.peek()
+  if err != nil {
+    return false, decoder.unexpectedEOF(err, "value or 'Z'")
+  }
+  return code == end, nil
+}
+
+// countTokenValue counts a value read in the fixed-length container opened last
+func (decoder *Decoder) countTokenValue() {
+  if n := len(decoder.tokens); n > 0 && decoder.tokens[n - 1].remaining > 0 {
+    decoder.tokens[n - 1].remaining--
+  }
+}
+
+func (decoder *Decoder) mapStart() (Token, error) {
+  code, err := decoder.read()
+  if err != nil {
+    return nil, err
+  }
+  var typeName string
+  switch {
+  case decoder.v1:
+    typeName, err = decoder.readTypeV1()
+  case code == 0x4d:
+    typeName, err = decoder.ReadType()
+  }
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "map")
+  }
+  if err := decoder.countRef(); err != nil {
+    return nil, err
+  }
+  decoder.tokens = append(decoder.tokens, tokenFrame{-1})
+  return MapStart{typeName}, nil
+}
+
+// objectStart reads the class definitions before the object as well
+func (decoder *Decoder) objectStart() (Token, error) {
+  code, err := decoder.peek()
+  if err != nil {
+    return nil, err
+  }
+  for code == 0x43 {
+    if _, err := decoder.ReadClassDef(); err != nil {
+      return nil, err
+    }
+    if code, err = decoder.peek(); err != nil {
+      return nil, decoder.unexpectedEOF(err, "object")
+    }
+  }
+  offset := decoder.offset
+  decoder.read()
+  var defId int32
+  switch {
+  case code == 0x4f:
+    if defId, err = decoder.ReadInt(); err != nil {
+      return nil, decoder.unexpectedEOF(err, "object")
+    }
+  case code >= 0x60 && code <= 0x6f:
+    defId = int32(code - 0x60)
+  default:
+    return nil, decoder.syntaxError(offset, code, "object")
+  }
+  if defId < 0 || int(defId) >= len(decoder.classDefs) {
+    return nil, &ReferenceError{offset, "class definition", defId}
+  }
+  def := decoder.classDefs[defId]
+  if err := decoder.countRef(); err != nil {
+    return nil, err
+  }
+  decoder.tokens = append(decoder.tokens, tokenFrame{len(def.Fields)})
+  return ObjectStart{def.ValueType, def.Fields}, nil
+}
+
+func (decoder *Decoder) refToken() (Token, error) {
+  decoder.read()
+  if decoder.v1 {
+    bits, err := decoder.readn(4)
+    if err != nil {
+      return nil, decoder.unexpectedEOF(err, "ref")
+    }
+    return Ref{parseInt32FromBytes(bits)}, nil
+  }
+  refId, err := decoder.ReadInt()
+  if err != nil {
+    return nil, decoder.unexpectedEOF(err, "ref")
+  }
+  return Ref{refId}, nil
+}
+
+// Skip reads over the next value with its nested values, without keeping them.
+// it returns an error at the End of a container opened by Token
+func (decoder *Decoder) Skip() error {
+  if len(decoder.tokens) > 0 {
+    end, err := decoder.atTokenEnd()
+    if err != nil {
+      return err
+    }
+    if end {
+      return errSkipEnd
+    }
+  }
+  level := len(decoder.tokens)
+  for {
+    if _, err := decoder.Token(); err != nil {
+      return err
+    }
+    if len(decoder.tokens) == level {
+      return nil
+    }
+  }
+}
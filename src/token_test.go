@@ -0,0 +1,78 @@
+package hessian
+
+import (
+  "errors"
+  "io"
+  "reflect"
+  "testing"
+)
+
+func TestDecoderToken(t *testing.T) {
+  row := &Object{"com.acme.Row", []string{"id", "tags"}, []interface{}{int32(1), List{UNTYPED, []interface{}{"a"}}}}
+  encoder := NewEncoder()
+  encoder.WriteValue(&List{"[com.acme.Row", []interface{}{row, row}})
+  encoder.WriteMap(map[interface{}]interface{}{"k": int64(2)})
+  decoder := NewDecoder(encoder.Bytes())
+  expect := []Token{
+    ListStart{"[com.acme.Row", 2},
+    ObjectStart{"com.acme.Row", []string{"id", "tags"}},
+    int32(1),
+    ListStart{UNTYPED, 1},
+    "a",
+    End{},
+    End{},
+    Ref{1},
+    End{},
+    MapStart{""},
+    "k",
+    int64(2),
+    End{},
+  }
+  for i, e := range expect {
+    token, err := decoder.Token()
+    unexpected_error(err, t)
+    if !reflect.DeepEqual(token, e) {
+      t.Errorf("token: %d expect %#v found %#v", i, e, token)
+    }
+  }
+  if _, err := decoder.Token(); err != io.EOF {
+    t.Errorf("token: expect EOF found %v", err)
+  }
+}
+
+func TestDecoderSkip(t *testing.T) {
+  encoder := NewEncoder()
+  encoder.WriteList(List{UNTYPED, []interface{}{
+    TypedMap{"com.acme.Big", map[string]interface{}{"v": List{"[int", []interface{}{int32(1), int32(2)}}}},
+    "keep",
+    int32(3),
+  }})
+  decoder := NewDecoder(encoder.Bytes())
+  token, err := decoder.Token()
+  unexpected_error(err, t)
+  if token != (ListStart{UNTYPED, 3}) {
+    t.Fatalf("skip: expect list start found %#v", token)
+  }
+  unexpected_error(decoder.Skip(), t)
+  // values of an open container may be read whole as well
+  v, err := decoder.ReadValue()
+  unexpected_error(err, t)
+  if v != "keep" {
+    t.Errorf("skip: expect keep found %v", v)
+  }
+  unexpected_error(decoder.Skip(), t)
+  if err := decoder.Skip(); err != errSkipEnd {
+    t.Errorf("skip: expect error at the end of the list found %v", err)
+  }
+  token, err = decoder.Token()
+  unexpected_error(err, t)
+  if token != (End{}) {
+    t.Errorf("skip: expect end found %#v", token)
+  }
+
+  // a truncated container
+  decoder = NewDecoder([]byte{0x57, 0x91})
+  if err := decoder.Skip(); !errors.Is(err, ErrUnexpectedEOF) {
+    t.Errorf("skip: expect unexpected EOF found %v", err)
+  }
+}
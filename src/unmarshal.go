@@ -0,0 +1,440 @@
+package hessian
+
+import (
+  "errors"
+  "fmt"
+  "reflect"
+  "sort"
+  "strings"
+  "time"
+  "unicode"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// struct field with its hessian name, taken from the `hessian` tag
+// or the go field name with the first letter lowered
+type field struct {
+  name string
+  index []int
+  omitEmpty bool
+}
+
+func parseTag(tag string) (string, bool) {
+  parts := strings.Split(tag, ",")
+  omitEmpty := false
+  for _, opt := range parts[1:] {
+    if opt == "omitempty" {
+      omitEmpty = true
+    }
+  }
+  return parts[0], omitEmpty
+}
+
+func lowerFirst(s string) string {
+  if s == "" {
+    return s
+  }
+  runes := []rune(s)
+  runes[0] = unicode.ToLower(runes[0])
+  return string(runes)
+}
+
+// typeFields returns the fields of struct type t, fields of embedded
+// structs without a tag name are promoted like java super class fields
+func typeFields(t reflect.Type) []field {
+  ret := []field{}
+  for i := 0; i < t.NumField(); i++ {
+    sf := t.Field(i)
+    tag := sf.Tag.Get("hessian")
+    if tag == "-" {
+      continue
+    }
+    name, omitEmpty := parseTag(tag)
+    ft := sf.Type
+    if ft.Kind() == reflect.Ptr {
+      ft = ft.Elem()
+    }
+    if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct && ft != timeType {
+      if sf.PkgPath != "" && sf.Type.Kind() == reflect.Ptr {
+        // can not allocate unexported embedded pointers
+        continue
+      }
+      for _, f := range typeFields(ft) {
+        f.index = append([]int{i}, f.index...)
+        ret = append(ret, f)
+      }
+      continue
+    }
+    if sf.PkgPath != "" {
+      // unexported
+      continue
+    }
+    if name == "" {
+      name = lowerFirst(sf.Name)
+    }
+    ret = append(ret, field{name, []int{i}, omitEmpty})
+  }
+  return ret
+}
+
+// Unmarshal decodes the first value of data into v, v must be a non-nil pointer
+func Unmarshal(data []byte, v interface{}) error {
+  return NewDecoder(data).Decode(v)
+}
+
+// Decode reads the next value and stores it into the value pointed to by v.
+// structs are filled from objects, typed maps and maps with string keys,
+// slices and arrays from lists, and time.Time from dates. a *RawMessage gets
+// the value as ReadRaw returns it, a RawMessage field its value encoded again
+func (decoder *Decoder) Decode(v interface{}) error {
+  rv := reflect.ValueOf(v)
+  if rv.Kind() != reflect.Ptr || rv.IsNil() {
+    return errors.New("decode error: non-nil pointer expected")
+  }
+  if raw, ok := v.(*RawMessage); ok {
+    ret, err := decoder.ReadRaw()
+    if err != nil {
+      return err
+    }
+    *raw = ret
+    return nil
+  }
+  // registered classes are resolved by assign, to the type of their destination
+  value, err := decoder.readValue()
+  if err != nil {
+    return err
+  }
+  // one assigner per decoder, refs to a value decoded before give its pointer
+  if decoder.resolver == nil {
+    decoder.resolver = newAssigner()
+  }
+  a := decoder.resolver
+  if key, ok := sharedKey(value, rv.Type()); ok {
+    a.seen[key] = rv
+  }
+  return a.assign(rv.Elem(), value)
+}
+
+// assigner keeps the pointer made for each shared list, map or object,
+// so refs and cycles decode to the same go pointer
+type assigner struct {
+  seen map[assignKey]reflect.Value
+  visited map[uintptr]bool // generic containers walked by resolve
+  custom map[uintptr]interface{} // values returned by deserializers
+}
+
+type assignKey struct {
+  ptr uintptr
+  t reflect.Type
+}
+
+func newAssigner() *assigner {
+  return &assigner{make(map[assignKey]reflect.Value), make(map[uintptr]bool), make(map[uintptr]interface{})}
+}
+
+// the identity of src when it can be shared through refs
+func sharedKey(src interface{}, t reflect.Type) (assignKey, bool) {
+  switch src.(type) {
+  case *List, *TypedMap, *Object, map[interface{}]interface{}:
+    return assignKey{reflect.ValueOf(src).Pointer(), t}, true
+  }
+  return assignKey{}, false
+}
+
+func assignError(dst reflect.Value, src interface{}) error {
+  return fmt.Errorf("decode error: cannot assign %T to %s", src, dst.Type())
+}
+
+func (a *assigner) assign(dst reflect.Value, src interface{}) error {
+  src, err := a.deserialize(src)
+  if err != nil {
+    return err
+  }
+  if dst.Type() == rawMessageType {
+    // the bytes of src are gone, it is encoded on its own
+    encoder := NewEncoder()
+    if err := encoder.WriteValue(src); err != nil {
+      return err
+    }
+    dst.SetBytes(append([]byte{}, encoder.Bytes()...))
+    return nil
+  }
+  if src == nil {
+    dst.Set(reflect.Zero(dst.Type()))
+    return nil
+  }
+  if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+    v, err := a.resolve(src)
+    if err != nil {
+      return err
+    }
+    // enums are names, unless decoded into a struct or map
+    if object, ok := v.(*Object); ok && isEnum(object) {
+      v = object.Value[0]
+    }
+    dst.Set(reflect.ValueOf(v))
+    return nil
+  }
+  sv := reflect.ValueOf(src)
+  if sv.Type().AssignableTo(dst.Type()) {
+    dst.Set(sv)
+    return nil
+  }
+  // registered classes are resolved to struct pointers
+  if sv.Kind() == reflect.Ptr && !sv.IsNil() && sv.Elem().Type().AssignableTo(dst.Type()) {
+    dst.Set(sv.Elem())
+    return nil
+  }
+  switch dst.Kind() {
+  case reflect.Ptr:
+    key, shared := sharedKey(src, dst.Type())
+    if shared {
+      if p, ok := a.seen[key]; ok {
+        dst.Set(p)
+        return nil
+      }
+    }
+    if dst.IsNil() {
+      dst.Set(reflect.New(dst.Type().Elem()))
+    }
+    if shared {
+      a.seen[key] = dst.Elem().Addr()
+    }
+    return a.assign(dst.Elem(), src)
+  case reflect.Bool:
+    b, ok := src.(bool)
+    if !ok {
+      return assignError(dst, src)
+    }
+    dst.SetBool(b)
+  case reflect.String:
+    // Decimal, Locale and other string types as well
+    if sv.Kind() == reflect.String {
+      dst.SetString(sv.String())
+      return nil
+    }
+    if object, ok := src.(*Object); ok && isEnum(object) {
+      dst.SetString(object.Value[0].(string))
+      return nil
+    }
+    u, ok := src.(UUID)
+    if !ok {
+      return assignError(dst, src)
+    }
+    dst.SetString(u.String())
+  case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    // int16 and int8 come from short and byte arrays
+    switch sv.Kind() {
+    case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    default:
+      return assignError(dst, src)
+    }
+    n := sv.Int()
+    if dst.OverflowInt(n) {
+      return fmt.Errorf("decode error: %d overflows %s", n, dst.Type())
+    }
+    dst.SetInt(n)
+  case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+    switch sv.Kind() {
+    case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+    default:
+      return assignError(dst, src)
+    }
+    n := sv.Int()
+    if n < 0 || dst.OverflowUint(uint64(n)) {
+      return fmt.Errorf("decode error: %d overflows %s", n, dst.Type())
+    }
+    dst.SetUint(uint64(n))
+  case reflect.Float32, reflect.Float64:
+    switch value := src.(type) {
+    case float64:
+      dst.SetFloat(value)
+    case float32:
+      dst.SetFloat(float64(value))
+    case int32:
+      dst.SetFloat(float64(value))
+    case int64:
+      dst.SetFloat(float64(value))
+    default:
+      return assignError(dst, src)
+    }
+  case reflect.Slice:
+    if b, ok := src.([]byte); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+      dst.SetBytes(append([]byte{}, b...))
+      return nil
+    }
+    values, ok := listValues(src)
+    if !ok {
+      return assignError(dst, src)
+    }
+    ret := reflect.MakeSlice(dst.Type(), values.Len(), values.Len())
+    for i := 0; i < values.Len(); i++ {
+      if err := a.assign(ret.Index(i), values.Index(i).Interface()); err != nil {
+        return err
+      }
+    }
+    dst.Set(ret)
+  case reflect.Array:
+    values, ok := listValues(src)
+    if !ok {
+      return assignError(dst, src)
+    }
+    if values.Len() > dst.Len() {
+      return fmt.Errorf("decode error: %d values overflow %s", values.Len(), dst.Type())
+    }
+    for i := 0; i < dst.Len(); i++ {
+      if i >= values.Len() {
+        dst.Index(i).Set(reflect.Zero(dst.Type().Elem()))
+        continue
+      }
+      if err := a.assign(dst.Index(i), values.Index(i).Interface()); err != nil {
+        return err
+      }
+    }
+  case reflect.Map:
+    entries := mapEntries(src)
+    if entries == nil {
+      return assignError(dst, src)
+    }
+    if dst.IsNil() {
+      dst.Set(reflect.MakeMap(dst.Type()))
+    }
+    for k, item := range entries {
+      key := reflect.New(dst.Type().Key()).Elem()
+      if err := a.assign(key, k); err != nil {
+        return err
+      }
+      value := reflect.New(dst.Type().Elem()).Elem()
+      if err := a.assign(value, item); err != nil {
+        return err
+      }
+      dst.SetMapIndex(key, value)
+    }
+  case reflect.Struct:
+    entries := mapEntries(src)
+    if entries == nil {
+      return assignError(dst, src)
+    }
+    return a.assignStruct(dst, src, entries)
+  default:
+    return assignError(dst, src)
+  }
+  return nil
+}
+
+// listValues returns the values of a *List, or of a go slice like the
+// []int32 read for java primitive arrays
+func listValues(src interface{}) (reflect.Value, bool) {
+  if l, ok := src.(*List); ok {
+    return reflect.ValueOf(l.Value), true
+  }
+  sv := reflect.ValueOf(src)
+  return sv, sv.Kind() == reflect.Slice
+}
+
+// mapEntries returns the key value pairs of maps, typed maps, objects and
+// registered structs, nil for any other value
+func mapEntries(src interface{}) map[interface{}]interface{} {
+  switch value := src.(type) {
+  case map[interface{}]interface{}:
+    return value
+  case *TypedMap:
+    ret := make(map[interface{}]interface{}, len(value.Value))
+    for k, item := range value.Value {
+      ret[k] = item
+    }
+    return ret
+  case *Object:
+    ret := make(map[interface{}]interface{}, len(value.Fields))
+    for i, name := range value.Fields {
+      ret[name] = value.Value[i]
+    }
+    return ret
+  }
+  // the struct pointers registered classes are resolved to
+  sv := reflect.ValueOf(src)
+  if sv.Kind() != reflect.Ptr || sv.IsNil() || sv.Elem().Kind() != reflect.Struct {
+    return nil
+  }
+  if _, ok := registeredName(sv.Elem().Type()); !ok {
+    return nil
+  }
+  fields := typeFields(sv.Elem().Type())
+  ret := make(map[interface{}]interface{}, len(fields))
+  for _, f := range fields {
+    if value, ok := fieldValue(sv.Elem(), f.index); ok {
+      ret[f.name] = value.Interface()
+    }
+  }
+  return ret
+}
+
+// assignStruct fills the fields of dst from the entries of src. an entry goes
+// to the field of the same name, or else to the first field in declaration
+// order with the name in another case, like encoding/json does
+func (a *assigner) assignStruct(dst reflect.Value, src interface{}, entries map[interface{}]interface{}) error {
+  fields := typeFields(dst.Type())
+  items := make([]interface{}, len(fields))
+  found := make([]bool, len(fields))
+  names := entryNames(src, entries)
+  exact := make(map[string]bool, len(names))
+  for i, f := range fields {
+    if item, ok := entries[f.name]; ok {
+      items[i], found[i] = item, true
+      exact[f.name] = true
+    }
+  }
+  for _, name := range names {
+    if exact[name] {
+      continue
+    }
+    for i, f := range fields {
+      if strings.EqualFold(name, f.name) {
+        if !found[i] {
+          items[i], found[i] = entries[name], true
+        }
+        break
+      }
+    }
+  }
+  for i, f := range fields {
+    if !found[i] {
+      continue
+    }
+    if err := a.assign(fieldByIndex(dst, f.index), items[i]); err != nil {
+      return err
+    }
+  }
+  return nil
+}
+
+// entryNames returns the string keys of entries in a fixed order, the field
+// order of an object or the sorted keys of a map
+func entryNames(src interface{}, entries map[interface{}]interface{}) []string {
+  if o, ok := src.(*Object); ok {
+    return o.Fields
+  }
+  names := make([]string, 0, len(entries))
+  for k := range entries {
+    if name, ok := k.(string); ok {
+      names = append(names, name)
+    }
+  }
+  sort.Strings(names)
+  return names
+}
+
+// like reflect.Value.FieldByIndex, but allocates nil embedded pointers
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+  for i, idx := range index {
+    if i > 0 && v.Kind() == reflect.Ptr {
+      if v.IsNil() {
+        v.Set(reflect.New(v.Type().Elem()))
+      }
+      v = v.Elem()
+    }
+    v = v.Field(idx)
+  }
+  return v
+}
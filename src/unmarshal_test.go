@@ -0,0 +1,125 @@
+package hessian
+
+import (
+  "testing"
+  "time"
+)
+
+type unmarshalCar struct {
+  Color string `hessian:"color"`
+  Model string
+  Mileage int `hessian:",omitempty"`
+  Ignored string `hessian:"-"`
+}
+
+type unmarshalOwner struct {
+  Name string
+  Cars []unmarshalCar
+  Favorite *unmarshalCar
+  Born time.Time
+  Tags map[string]int
+}
+
+func TestUnmarshalStruct(t *testing.T) {
+  /**
+   * class Car {
+   *   String color;
+   *   String model;
+   *   int mileage;
+   * }
+   * new Car("red", "corvette", 65536)
+   */
+  code := []byte{0x43, 0x0b, 0x65, 0x78, 0x61, 0x6d, 0x70, 0x6c, 0x65, 0x2e, 0x43, 0x61, 0x72, 0x93,
+    0x05, 0x63, 0x6f, 0x6c, 0x6f, 0x72, 0x05, 0x6d, 0x6f, 0x64, 0x65, 0x6c, 0x07, 0x6d, 0x69, 0x6c, 0x65, 0x61, 0x67, 0x65,
+    0x60, 0x03, 0x72, 0x65, 0x64, 0x08, 0x63, 0x6f, 0x72, 0x76, 0x65, 0x74, 0x74, 0x65, 0xd5, 0x00, 0x00}
+  var car unmarshalCar
+  err := Unmarshal(code, &car)
+  unexpected_error(err, t)
+  if car.Color != "red" || car.Model != "corvette" || car.Mileage != 65536 {
+    t.Errorf("unmarshal: struct decode error, found %+v", car)
+  }
+}
+
+func TestUnmarshalNested(t *testing.T) {
+  car := TypedMap{"example.Car", map[string]interface{}{"color": "red", "model": "corvette", "ignored": "x"}}
+  encoder := NewEncoder()
+  encoder.WriteTypedMap(TypedMap{"example.Owner", map[string]interface{}{
+    "name": "ysp",
+    "cars": List{"[example.Car", []interface{}{car, car}},
+    "favorite": car,
+    "born": time.Unix(11724480 * 60, 0),
+    "tags": map[interface{}]interface{}{"a": int32(1), "b": int64(2)},
+  }})
+  var owner unmarshalOwner
+  err := NewDecoder(encoder.Bytes()).Decode(&owner)
+  unexpected_error(err, t)
+  if owner.Name != "ysp" || len(owner.Cars) != 2 || owner.Cars[1].Model != "corvette" {
+    t.Errorf("unmarshal: nested decode error, found %+v", owner)
+  }
+  if owner.Favorite == nil || owner.Favorite.Color != "red" || owner.Favorite.Ignored != "" {
+    t.Errorf("unmarshal: pointer decode error")
+  }
+  if owner.Born.Unix() != 11724480 * 60 {
+    t.Errorf("unmarshal: time decode error")
+  }
+  if owner.Tags["a"] != 1 || owner.Tags["b"] != 2 {
+    t.Errorf("unmarshal: map decode error")
+  }
+}
+
+func TestDecodeSharedRef(t *testing.T) {
+  // a ref in the second value to the object of the first
+  node := &Object{"example.Node", []string{"name", "next"}, []interface{}{"a", nil}}
+  encoder := NewEncoder()
+  encoder.WriteValue(node)
+  encoder.WriteValue(&List{UNTYPED, []interface{}{node}})
+  decoder := NewDecoder(encoder.Bytes())
+  var first *refNode
+  var rest []*refNode
+  unexpected_error(decoder.Decode(&first), t)
+  unexpected_error(decoder.Decode(&rest), t)
+  if len(rest) != 1 || rest[0] != first || first.Name != "a" {
+    t.Errorf("decode: expect the ref to give the first pointer found %v %v", first, rest)
+  }
+}
+
+func TestUnmarshalFieldCase(t *testing.T) {
+  type caseFields struct {
+    First string `hessian:"value"`
+    Second string `hessian:"Value"`
+    Other string `hessian:"other"`
+  }
+  // exact names first, then the first field in declaration order
+  for i := 0; i < 20; i++ {
+    code := encoded(Object{"example.Case", []string{"VALUE", "Value", "OTHER", "Other"}, []interface{}{"a", "b", "c", "d"}})
+    var v caseFields
+    unexpected_error(Unmarshal(code, &v), t)
+    if v.First != "a" || v.Second != "b" || v.Other != "c" {
+      t.Errorf("unmarshal: field case expect {a b c} found %+v", v)
+    }
+  }
+}
+
+func TestUnmarshalError(t *testing.T) {
+  {
+    var n int8
+    err := Unmarshal([]byte{0xd5, 0x00, 0x00}, &n)
+    if err == nil {
+      t.Errorf("unmarshal should return overflow error")
+    }
+  }
+  {
+    var s string
+    err := Unmarshal([]byte{0x91}, &s)
+    if err == nil {
+      t.Errorf("unmarshal should return type error")
+    }
+  }
+  {
+    var s string
+    err := Unmarshal([]byte{0x01, 0x61}, s)
+    if err == nil {
+      t.Errorf("unmarshal should reject non-pointer")
+    }
+  }
+}
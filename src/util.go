@@ -52,7 +52,7 @@ func parseInt32(sign int8, bits []byte) int32 {
 	var ret int32
 	ret += int32(sign) << uint(l*8)
 	for i := 0; i < l; i++ {
-		ret += int32(bits[i] << uint((l-i-1)*8))
+		ret += int32(bits[i]) << uint((l-i-1)*8)
 	}
 	return ret
 }
@@ -73,3 +73,21 @@ func parseInt64(sign int8, bits []byte) int64 {
 	return ret
 }
 
+
+func int32ToBytes(v int32) []byte {
+  bits := make([]byte, 4)
+  binary.BigEndian.PutUint32(bits, uint32(v))
+  return bits
+}
+
+func int64ToBytes(v int64) []byte {
+  bits := make([]byte, 8)
+  binary.BigEndian.PutUint64(bits, uint64(v))
+  return bits
+}
+
+func float64ToBytes(v float64) []byte {
+  bits := make([]byte, 8)
+  binary.BigEndian.PutUint64(bits, math.Float64bits(v))
+  return bits
+}